@@ -0,0 +1,123 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Capture format is a file header followed by records. Every record is
+// a FAST-encoded message prefixed by its length as big-endian uint32.
+const (
+	captureMagic   = "FAST"
+	captureVersion = 1
+)
+
+var (
+	// ErrCaptureHeader is returned if a stream does not start with a valid capture header.
+	ErrCaptureHeader = errors.New("capture: invalid header")
+
+	// ErrCaptureRecord is returned if a message does not match bounds of its capture record.
+	ErrCaptureRecord = errors.New("capture: message does not match record length")
+)
+
+// NewCaptureEncoder returns a new encoder that writes capture header to writer
+// and then writes every encoded message as length-prefixed record.
+func NewCaptureEncoder(writer io.Writer, tmps ...*Template) (*Encoder, error) {
+	header := append([]byte(captureMagic), captureVersion)
+	if _, err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	encoder := NewEncoder(writer, tmps...)
+	encoder.capture = true
+	return encoder, nil
+}
+
+// NewCaptureDecoder returns a new decoder that reads capture header from reader
+// and then reads every message from its length-prefixed record.
+func NewCaptureDecoder(reader io.Reader, tmps ...*Template) (*Decoder, error) {
+	header := make([]byte, len(captureMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrCaptureHeader
+		}
+		return nil, err
+	}
+
+	if string(header[:len(captureMagic)]) != captureMagic || header[len(captureMagic)] != captureVersion {
+		return nil, ErrCaptureHeader
+	}
+
+	capture := &captureReader{reader: reader}
+	decoder := NewDecoder(capture, tmps...)
+	decoder.capture = capture
+	return decoder, nil
+}
+
+func writeRecord(writer io.Writer, data []byte) error {
+	prefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(prefix, uint32(len(data)))
+	if _, err := writer.Write(prefix); err != nil {
+		return err
+	}
+	_, err := writer.Write(data)
+	return err
+}
+
+// captureReader reads messages record by record. Read never crosses bounds
+// of the current record.
+type captureReader struct {
+	reader io.Reader
+	record bytes.Reader
+	prefix [4]byte
+	data   []byte
+}
+
+func (c *captureReader) next() error {
+	if _, err := io.ReadFull(c.reader, c.prefix[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(c.prefix[:])
+	if uint32(cap(c.data)) < size {
+		c.data = make([]byte, size)
+	}
+	c.data = c.data[:size]
+
+	if _, err := io.ReadFull(c.reader, c.data); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	c.record.Reset(c.data)
+	return nil
+}
+
+func (c *captureReader) Read(b []byte) (int, error) {
+	if c.record.Len() == 0 {
+		return 0, ErrCaptureRecord
+	}
+	return c.record.Read(b)
+}
+
+// rest returns unread bytes of the current record.
+func (c *captureReader) rest() []byte {
+	data := make([]byte, c.record.Len())
+	_, _ = c.record.Read(data)
+	return data
+}
+
+func (c *captureReader) done() error {
+	if c.record.Len() > 0 {
+		return ErrCaptureRecord
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fast_test
+
+import (
+	"bytes"
+	"github.com/co11ter/goFAST"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	tpls := decoderTemplates(t)
+	buf := &bytes.Buffer{}
+
+	enc, err := fast.NewCaptureEncoder(buf, tpls...)
+	if err != nil {
+		t.Fatal("can not create encoder", err)
+	}
+
+	messages := []interface{}{&decimalMessage1, &stringMessage1, &integerMessage1}
+	for _, msg := range messages {
+		if err = enc.Encode(msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+	}
+
+	dec, err := fast.NewCaptureDecoder(buf, tpls...)
+	if err != nil {
+		t.Fatal("can not create decoder", err)
+	}
+
+	got := []interface{}{&decimalType{}, &stringType{}, &integerType{}}
+	for i, msg := range got {
+		if err = dec.Decode(msg); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if !reflect.DeepEqual(msg, messages[i]) {
+			t.Fatal("messages is not equal, got: ", msg, ", expect: ", messages[i])
+		}
+	}
+
+	if err = dec.Decode(&decimalType{}); err != io.EOF {
+		t.Fatal("expected EOF, got: ", err)
+	}
+}
+
+func TestCaptureHeader(t *testing.T) {
+	_, err := fast.NewCaptureDecoder(bytes.NewReader(decimalData1), decoderTemplates(t)...)
+	if err != fast.ErrCaptureHeader {
+		t.Fatal("not found err: '", fast.ErrCaptureHeader, "' got '", err, "'")
+	}
+}
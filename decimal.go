@@ -5,6 +5,12 @@ import (
 	"math"
 )
 
+// decimalValue is a dictionary value of decimal with delta operator.
+type decimalValue struct {
+	mantissa int64
+	exponent int32
+}
+
 // TODO int will be able overflow if exponent < 0 ??
 func newFloat(mantissa int64, exponent int32) (f float64) {
 	return float64(mantissa)/math.Pow10(int(exponent) * -1)
@@ -18,6 +24,113 @@ func newMantExp(f float64) (int64, int32) {
 	return d.Coefficient().Int64(), d.Exponent()
 }
 
+// RoundingMode specifies how a value is rounded to the fixed exponent of
+// decimal field. The default mode is RoundHalfUp.
+type RoundingMode int
+
+// Rounding modes of decimal field
+const (
+	// RoundHalfUp rounds half away from zero: 1.005 -> 1.01, -1.005 -> -1.01.
+	RoundHalfUp RoundingMode = iota
+
+	// RoundHalfEven rounds half to the nearest even digit: 1.005 -> 1.00, 1.015 -> 1.02.
+	RoundHalfEven
+
+	// RoundDown truncates extra digits: 1.009 -> 1.00, -1.009 -> -1.00.
+	RoundDown
+)
+
+// newScaledMantExp returns mantissa of float64 or decimal.Decimal value for fixed exponent.
+func newScaledMantExp(value interface{}, exponent int32, mode RoundingMode) (int64, int32) {
+	d := toDecimal(value).Shift(-exponent)
+	switch mode {
+	case RoundHalfEven:
+		d = d.RoundBank(0)
+	case RoundDown:
+		d = d.Truncate(0)
+	default:
+		d = d.Round(0)
+	}
+	return d.IntPart(), exponent
+}
+
+// mantExpOf returns mantissa and exponent of float64 or decimal.Decimal value.
+func mantExpOf(value interface{}) (int64, int32) {
+	if d, ok := value.(decimal.Decimal); ok {
+		return d.Coefficient().Int64(), d.Exponent()
+	}
+	return newMantExp(value.(float64))
+}
+
+// newDecimal returns decimal.Decimal in exact mode or float64 otherwise.
+func newDecimal(mantissa int64, exponent int32, exact bool) interface{} {
+	if exact {
+		return decimal.New(mantissa, exponent)
+	}
+	return newFloat(mantissa, exponent)
+}
+
+// toFloat converts decoded decimal.Decimal value to float64.
+func toFloat(value interface{}) interface{} {
+	if d, ok := value.(decimal.Decimal); ok {
+		return newFloat(d.Coefficient().Int64(), d.Exponent())
+	}
+	return value
+}
+
+// formatDecimal returns string of decimal keeping trailing zeros of mantissa: 1.50.
+func formatDecimal(d decimal.Decimal) string {
+	if d.Exponent() < 0 {
+		return d.StringFixed(-d.Exponent())
+	}
+	return d.String()
+}
+
+func toDecimal(value interface{}) decimal.Decimal {
+	if d, ok := value.(decimal.Decimal); ok {
+		return d
+	}
+	return decimal.NewFromFloat(value.(float64))
+}
+
+// normalizeDecimal removes trailing zeros of mantissa of decimal.Decimal or
+// float64 value, so numerically equal decimals have equal mantissa and
+// exponent: 1.50 -> 1.5. The result is decimal.Decimal.
+func normalizeDecimal(value interface{}) interface{} {
+	if !isDecimalValue(value) {
+		return value
+	}
+
+	mantissa, exponent := mantExpOf(value)
+	if mantissa == 0 {
+		return decimal.New(0, 0)
+	}
+	for mantissa%10 == 0 {
+		mantissa /= 10
+		exponent++
+	}
+	return decimal.New(mantissa, exponent)
+}
+
+// normalizeInstructions returns copies of instructions with normalized
+// initial values of decimals.
+func normalizeInstructions(data []*Instruction) []*Instruction {
+	if data == nil {
+		return nil
+	}
+
+	res := make([]*Instruction, len(data))
+	for n, in := range data {
+		tmp := *in
+		if tmp.Type == TypeDecimal && tmp.Value != nil {
+			tmp.Value = normalizeDecimal(tmp.Value)
+		}
+		tmp.Instructions = normalizeInstructions(in.Instructions)
+		res[n] = &tmp
+	}
+	return res
+}
+
 func expDecimal(f float64) int32 {
 	return decimal.NewFromFloat(f).Exponent()
 }
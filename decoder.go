@@ -5,10 +5,22 @@
 package fast
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"sync"
 )
 
+// defaultMaxDepth is the default maximum nesting depth of groups and sequences.
+const defaultMaxDepth = 32
+
+// ErrMaxDepth is returned if nesting of groups and sequences exceeds maximum depth of decoder.
+var ErrMaxDepth = errors.New("decoder: maximum nesting depth exceeded")
+
+// ErrUnboundedRest is returned if message with rest field is decoded from a
+// stream, where the end of message is unknown.
+var ErrUnboundedRest = errors.New("decoder: rest field requires bounded message")
+
 // A Decoder reads and decodes FAST-encoded message from an io.Reader.
 // You may need buffered reader since decoder reads data byte by byte.
 type Decoder struct {
@@ -22,6 +34,16 @@ type Decoder struct {
 	msg Receiver
 
 	logger *readerLog
+	tap *readerTap
+	trace *DecodeTrace
+	capture *captureReader
+	merge bool // do not reset message before decoding
+	bounded bool // reader contains the only message
+	maxPmap int // max length of presence map in bytes
+	exactDecimal bool // keep exponent of decoded decimals
+	rewrites map[uint]map[string]func(interface{}) interface{}
+	depth int // current nesting depth of groups and sequences
+	maxDepth int
 	mu sync.Mutex
 }
 
@@ -32,6 +54,7 @@ func NewDecoder(reader io.Reader, tmps ...*Template) *Decoder {
 		storage: newStorage(),
 		reader: newReader(reader),
 		pmc: newPMapCollector(),
+		maxDepth: defaultMaxDepth,
 	}
 	for _, t := range tmps {
 		decoder.repo[t.ID] = t.clone()
@@ -43,7 +66,68 @@ func NewDecoder(reader io.Reader, tmps ...*Template) *Decoder {
 func (d *Decoder) Reset() {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	d.storage = newStorage()
+	d.storage.clear()
+}
+
+// SetMerge sets merge mode. By default Decode resets the message to zero value
+// before decoding, slices of sequences keep their capacity. In merge mode
+// Decode only overwrites fields present in the current message and keeps
+// existing values of absent fields. Merge mode does not affect messages
+// implementing Receiver.
+//
+// Breaking change: Decode of previous versions kept values of absent fields,
+// merge mode has to be enabled to keep that behaviour.
+func (d *Decoder) SetMerge(merge bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.merge = merge
+}
+
+// SetMaxDepth sets maximum nesting depth of groups and sequences. Decode
+// returns ErrMaxDepth if the depth is exceeded. The default depth is 32.
+func (d *Decoder) SetMaxDepth(depth int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxDepth = depth
+}
+
+// SetDecodeRewrite registers fn to rewrite decoded value of field with name
+// fieldName of template with id templateID before the value is set to message.
+// Rewrite function is called for absent fields too with nil value.
+// Nil fn removes rewrite function of the field.
+func (d *Decoder) SetDecodeRewrite(templateID uint, fieldName string, fn func(interface{}) interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fn == nil {
+		delete(d.rewrites[templateID], fieldName)
+		return
+	}
+	if d.rewrites == nil {
+		d.rewrites = make(map[uint]map[string]func(interface{}) interface{})
+	}
+	if d.rewrites[templateID] == nil {
+		d.rewrites[templateID] = make(map[string]func(interface{}) interface{})
+	}
+	d.rewrites[templateID][fieldName] = fn
+}
+
+// SetExactDecimal sets exact decimal mode. By default decimals are decoded as
+// float64, so trailing zeros of mantissa are lost: 1.50 -> 1.5. In exact mode
+// decimals are decoded as decimal.Decimal with exponent from the stream. Such
+// value may be assigned to decimal.Decimal, string (keeping trailing zeros)
+// or float64 field of message.
+func (d *Decoder) SetExactDecimal(exact bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.exactDecimal = exact
+}
+
+// MaxPmapBytes returns the maximum length of presence map in bytes
+// observed by the decoder. It may be used to tune buffer sizes for a feed.
+func (d *Decoder) MaxPmapBytes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.maxPmap
 }
 
 // SetLog sets writer for logging
@@ -71,9 +155,77 @@ func (d *Decoder) Decode(msg interface{}) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	return d.decode(msg)
+}
+
+// DecodeRaw works like Decode, but also returns raw bytes consumed for each
+// presence map, template id and field of the message in order of decoding.
+// Concatenation of all RawField.Data gives the full encoded message.
+func (d *Decoder) DecodeRaw(msg interface{}) ([]RawField, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	src := d.reader.reader
+	d.tap = &readerTap{Reader: src}
+	d.reader.reader = d.tap
+	defer func() {
+		d.reader.reader = src
+		d.tap = nil
+	}()
+
+	err := d.decode(msg)
+	return d.tap.fields, err
+}
+
+// DecodeTrace works like Decode, but also records presence map bits read
+// for template id, groups and fields of the message and their operators.
+func (d *Decoder) DecodeTrace(msg interface{}) (*DecodeTrace, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.trace = &DecodeTrace{}
+	defer func() {
+		d.trace = nil
+	}()
+
+	trace := d.trace
+	err := d.decode(msg)
+	return trace, err
+}
+
+// DecodeEmbedded decodes FAST-encoded message embedded into data, e.g. value
+// of byte vector field, and stores it in the value pointed to by msg. Message
+// is decoded with empty dictionary by tpls or by templates of decoder, if tpls
+// is empty. The dictionary and the reader of decoder are not changed.
+func (d *Decoder) DecodeEmbedded(data []byte, tpls []*Template, msg interface{}) error {
+	d.mu.Lock()
+	embedded := NewDecoder(bytes.NewReader(data), tpls...)
+	if len(tpls) == 0 {
+		for id, tpl := range d.repo {
+			embedded.repo[id] = tpl
+		}
+	}
+	embedded.bounded = true
+	embedded.merge = d.merge
+	embedded.exactDecimal = d.exactDecimal
+	embedded.maxDepth = d.maxDepth
+	d.mu.Unlock()
+
+	return embedded.Decode(msg)
+}
+
+func (d *Decoder) decode(msg interface{}) error {
 	d.tid = 0
+	d.depth = 0
+	d.reader.exactDecimal = d.exactDecimal
 	d.pmc.reset()
 
+	if d.capture != nil {
+		if err := d.capture.next(); err != nil {
+			return err
+		}
+	}
+
 	if d.logger != nil {
 		d.logger.prefix = "\n"
 		d.logger.Log("// ----- new message start ----- //")
@@ -85,6 +237,15 @@ func (d *Decoder) Decode(msg interface{}) error {
 		return err
 	}
 
+	// message is started, so the end of reader is unexpected
+	err = d.decodeMessage(msg)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (d *Decoder) decodeMessage(msg interface{}) (err error) {
 	if d.logger != nil {
 		d.logger.Log("  pmap = ", *d.pmc.active(), "\ntemplate decoding: ")
 	}
@@ -104,10 +265,50 @@ func (d *Decoder) Decode(msg interface{}) error {
 	}
 
 	if d.msg, ok = msg.(Receiver); !ok {
-		d.msg = makeMsg(msg)
+		m := makeMsg(msg)
+		if !d.merge {
+			m.reset()
+		}
+		d.msg = m
 	}
 	d.msg.SetTemplateID(d.tid)
-	return d.decodeSegment(tpl.Instructions)
+	err = d.decodeSegment(tpl.Instructions)
+	if err != nil {
+		return err
+	}
+
+	if m, ok := d.msg.(*reflector); ok && m.registers[0].rest != nil {
+		rest, err := d.readRest()
+		if err != nil {
+			return err
+		}
+		m.setRest(rest)
+		if d.tap != nil && len(rest) > 0 {
+			if d.capture != nil {
+				// rest of capture record is not read through the tap
+				d.tap.buf = append(d.tap.buf, rest...)
+			}
+			d.tap.capture(nil, "rest", rest)
+		}
+	}
+
+	if d.capture == nil {
+		return nil
+	}
+	return d.capture.done()
+}
+
+// readRest reads trailing bytes of message: the rest of capture record or
+// the rest of embedded data. The stream of messages has no boundaries, so
+// other decoders return ErrUnboundedRest.
+func (d *Decoder) readRest() ([]byte, error) {
+	if d.capture != nil {
+		return d.capture.rest(), nil
+	}
+	if !d.bounded {
+		return nil, ErrUnboundedRest
+	}
+	return io.ReadAll(d.reader.reader)
 }
 
 func (d *Decoder) visitPMap() error {
@@ -117,18 +318,70 @@ func (d *Decoder) visitPMap() error {
 	}
 
 	d.pmc.append(m)
+	if d.reader.pmapBytes > d.maxPmap {
+		d.maxPmap = d.reader.pmapBytes
+	}
+	if d.tap != nil {
+		d.tap.capture(nil, "pmap", m.String())
+	}
 	return nil
 }
 
+// traceStep records bits of active presence map read since mask.
+func (d *Decoder) traceStep(name string, operator InstructionOperator, mask uint64) {
+	if d.trace != nil {
+		d.trace.add(name, operator, d.pmc.active(), mask, d.pmc.active().mask)
+	}
+}
+
+// traceDecimal records steps of exponent and mantissa of decimal with individual
+// operators. Mantissa is not read if exponent is absent.
+func (d *Decoder) traceDecimal(instruction *Instruction, mask uint64, absent bool) {
+	if d.trace == nil {
+		return
+	}
+	pmap := d.pmc.active()
+	for _, in := range instruction.Instructions {
+		end := mask
+		if in.hasPmapBit() {
+			end = mask >> 1
+		}
+		if in.Type == TypeExponent {
+			d.trace.add(instruction.Name+"."+tagExponent, in.Operator, pmap, mask, end)
+			if absent {
+				return
+			}
+		} else {
+			d.trace.add(instruction.Name+"."+tagMantissa, in.Operator, pmap, mask, end)
+		}
+		mask = end
+	}
+}
+
+// visitTemplateID reads template id. Template id is encoded as copy field,
+// so the previous template id is used if the id is not present in the stream.
 func (d *Decoder) visitTemplateID() (uint, error) {
-	if d.pmc.active().IsNextBitSet() {
+	mask := d.pmc.active().mask
+	set := d.pmc.active().IsNextBitSet()
+	d.traceStep(templateIDKey, OperatorCopy, mask)
+
+	if set {
 		tmp, err := d.reader.ReadUint(false)
 		if err != nil {
 			return 0, err
 		}
+		if d.tap != nil {
+			d.tap.capture(nil, "*", uint(*tmp))
+		}
+		d.storage.save(templateIDKey, uint(*tmp))
 		return uint(*tmp), nil
 	}
-	return 0, nil
+
+	previous := d.storage.load(templateIDKey)
+	if previous == nil {
+		return 0, ErrD5
+	}
+	return previous.(uint), nil
 }
 
 func (d *Decoder) decodeGroup(instruction *Instruction) error {
@@ -136,11 +389,16 @@ func (d *Decoder) decodeGroup(instruction *Instruction) error {
 		d.logger.Log("group start: ")
 	}
 
-	if instruction.isOptional() && !d.pmc.active().IsNextBitSet() {
-		if d.logger != nil {
-			d.logger.Log("group is empty")
+	if instruction.isOptional() {
+		mask := d.pmc.active().mask
+		set := d.pmc.active().IsNextBitSet()
+		d.traceStep(instruction.Name, instruction.Operator, mask)
+		if !set {
+			if d.logger != nil {
+				d.logger.Log("group is empty")
+			}
+			return nil
 		}
-		return nil
 	}
 
 	parent := acquireField()
@@ -183,10 +441,16 @@ func (d *Decoder) decodeSequence(instruction *Instruction) error {
 		d.logger.Log("sequence start: ")
 	}
 
+	mask := d.pmc.active().mask
 	tmp, err := instruction.Instructions[0].extract(d.reader, d.storage, d.pmc.active())
 	if err != nil {
 		return err
 	}
+	d.traceStep(instruction.Instructions[0].Name, instruction.Instructions[0].Operator, mask)
+
+	if d.tap != nil {
+		d.tap.capture(instruction.Instructions[0], instruction.Instructions[0].Name, tmp)
+	}
 
 	if tmp == nil {
 		return nil
@@ -251,10 +515,17 @@ func (d *Decoder) decodeSegment(instructions []*Instruction) error {
 	var err error
 	for _, instruction := range instructions {
 		switch instruction.Type {
-		case TypeSequence:
-			err = d.decodeSequence(instruction)
-		case TypeGroup:
-			err = d.decodeGroup(instruction)
+		case TypeSequence, TypeGroup:
+			if d.depth >= d.maxDepth {
+				return ErrMaxDepth
+			}
+			d.depth++
+			if instruction.Type == TypeSequence {
+				err = d.decodeSequence(instruction)
+			} else {
+				err = d.decodeGroup(instruction)
+			}
+			d.depth--
 		default:
 			if d.logger != nil {
 				d.logger.Log("decoding: ", instruction.Name)
@@ -265,10 +536,36 @@ func (d *Decoder) decodeSegment(instructions []*Instruction) error {
 			field := acquireField()
 			field.ID = instruction.ID
 			field.Name = instruction.Name
+			mask := d.pmc.active().mask
+			if instruction.Type == TypeUnicodeString {
+				m, ok := d.msg.(*reflector)
+				d.reader.unicodeBytes = ok && m.isBytes(field)
+			}
 			field.Value, err = instruction.extract(d.reader, d.storage, d.pmc.active())
 			if err != nil {
 				return err
 			}
+			if instruction.Type == TypeDecimal && len(instruction.Instructions) > 0 {
+				d.traceDecimal(instruction, mask, field.Value == nil)
+			} else {
+				d.traceStep(instruction.Name, instruction.Operator, mask)
+			}
+			if instruction.Type == TypeDecimal && !d.exactDecimal {
+				// initial value of decimal is decimal.Decimal
+				field.Value = toFloat(field.Value)
+			}
+			if b, ok := field.Value.([]byte); ok && instruction.Type == TypeUnicodeString && !d.reader.unicodeBytes {
+				// previous value may be decoded for []byte field
+				field.Value = string(b)
+			}
+
+			if d.tap != nil {
+				d.tap.capture(instruction, field.Name, field.Value)
+			}
+
+			if fn, ok := d.rewrites[d.tid][field.Name]; ok {
+				field.Value = fn(field.Value)
+			}
 
 			if d.logger != nil {
 				d.logger.Log("  ", field.Name, " = ", field.Value)
@@ -276,6 +573,9 @@ func (d *Decoder) decodeSegment(instructions []*Instruction) error {
 
 			if field.Value != nil {
 				d.msg.SetValue(field)
+				if m, ok := d.msg.(*reflector); ok && m.err != nil {
+					return m.err
+				}
 			}
 			releaseField(field)
 		}
@@ -0,0 +1,41 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+
+package fast
+
+import (
+	"io"
+	"iter"
+	"reflect"
+)
+
+// All returns an iterator over messages of reader. Every message is decoded
+// to a new value of the same type as prototype, which must be a pointer.
+// Iteration stops at the end of reader or after the first yielded error.
+func (d *Decoder) All(prototype interface{}) iter.Seq2[interface{}, error] {
+	typ := reflect.TypeOf(prototype)
+	return func(yield func(interface{}, error) bool) {
+		if typ == nil || typ.Kind() != reflect.Ptr {
+			yield(nil, ErrD1)
+			return
+		}
+
+		for {
+			msg := reflect.New(typ.Elem()).Interface()
+			err := d.Decode(msg)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
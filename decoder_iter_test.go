@@ -0,0 +1,52 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+
+package fast_test
+
+import (
+	"bytes"
+	"github.com/co11ter/goFAST"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDecoder_All(t *testing.T) {
+	buf := &bytes.Buffer{}
+	for i := 0; i < 3; i++ {
+		buf.Write(integerData1)
+	}
+
+	var msgs []interface{}
+	dec := fast.NewDecoder(buf, decoderTemplates(t)...)
+	for msg, err := range dec.All(&integerType{}) {
+		if err != nil {
+			t.Fatal("can not decode", err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if len(msgs) != 3 {
+		t.Fatal("wrong count of messages: ", len(msgs))
+	}
+	for _, msg := range msgs {
+		if !reflect.DeepEqual(msg, &integerMessage1) {
+			t.Fatal("messages is not equal, got: ", msg, ", expect: ", integerMessage1)
+		}
+	}
+	if msgs[0] == msgs[1] {
+		t.Fatal("messages are not fresh values")
+	}
+
+	buf.Write(integerData1[:5])
+	var errs []error
+	for _, err := range dec.All(&integerType{}) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] != io.ErrUnexpectedEOF {
+		t.Fatal("expected only error of incomplete message, got: ", errs)
+	}
+}
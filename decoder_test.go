@@ -6,11 +6,14 @@ package fast_test
 
 import (
 	"bytes"
+	"errors"
 	"github.com/co11ter/goFAST"
+	"github.com/shopspring/decimal"
 	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -82,6 +85,650 @@ func TestGroupDecode(t *testing.T) {
 	decode(groupData1, &msg, &groupMessage1, t)
 }
 
+func TestRawDecode(t *testing.T) {
+	buf := bytes.NewBuffer(decimalData1)
+	dec := fast.NewDecoder(buf, decoderTemplates(t)...)
+
+	var msg decimalType
+	fields, err := dec.DecodeRaw(&msg)
+	if err != nil {
+		t.Fatal("can not decode", err)
+	}
+
+	if !reflect.DeepEqual(&msg, &decimalMessage1) {
+		t.Fatal("messages is not equal, got: ", msg, ", expect: ", decimalMessage1)
+	}
+
+	expect := []struct {
+		name string
+		data []byte
+	}{
+		{"pmap", []byte{0xf8}},
+		{"*", []byte{0x81}},
+		{"CopyDecimal", []byte{0xfe, 0x04, 0x83}},
+		{"MandatoryDecimal", []byte{0xff, 0x0c, 0x8a}},
+		{"IndividualDecimal", []byte{0xfc, 0xa0}},
+		{"IndividualDecimalOpt", []byte{0xff, 0x00, 0xef}},
+	}
+	if len(fields) != len(expect) {
+		t.Fatalf("wrong count of raw fields, got: %d, expect: %d", len(fields), len(expect))
+	}
+
+	var data []byte
+	for i, field := range fields {
+		if field.Name != expect[i].name || !bytes.Equal(field.Data, expect[i].data) {
+			t.Fatalf("raw field is not equal, got: %s %x, expect: %s %x",
+				field.Name, field.Data, expect[i].name, expect[i].data)
+		}
+		data = append(data, field.Data...)
+	}
+
+	if !bytes.Equal(data, decimalData1) {
+		t.Fatalf("raw data is not equal, got: %x, expect: %x", data, decimalData1)
+	}
+}
+
+func TestFieldUnmarshalerDecode(t *testing.T) {
+	var msg currencyType
+	expect := currencyType{
+		TemplateID:       4,
+		MandatoryAscii:   "ABC",
+		OptionalAscii:    "def",
+		MandatoryUnicode: "ghi",
+		OptionalUnicode:  "klm",
+	}
+	decode(stringData1, &msg, &expect, t)
+
+	data := []byte{0xc0, 0x84, 0x61, 0x62, 0x63, 0xe4, 0x64, 0x65, 0xe6, 0x83, 0x67, 0x68, 0x69, 0x84, 0x6b, 0x6c, 0x6d}
+	dec := fast.NewDecoder(bytes.NewBuffer(data), decoderTemplates(t)...)
+	if err := dec.Decode(&msg); err != errInvalidCurrency {
+		t.Fatal("not found err: '", errInvalidCurrency, "' got '", err, "'")
+	}
+}
+
+func TestTemplateIDCopyDecode(t *testing.T) {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{0xe0, 0x87, 0x85}) // increment template with SeqNum 5
+	buf.Write([]byte{0x80})             // template id and SeqNum are omitted
+	buf.Write(integerData1)
+	buf.Write([]byte{0x80})             // template id is omitted
+	buf.Write(integerData1[2:])
+	buf.Write([]byte{0xc0, 0x87})       // increment template, SeqNum is omitted
+	buf.Write([]byte{0x80})             // template id and SeqNum are omitted
+
+	dec := fast.NewDecoder(buf, decoderTemplates(t)...)
+	expect := []interface{}{
+		&incrementType{TemplateID: 7, SeqNum: 5},
+		&incrementType{TemplateID: 7, SeqNum: 6},
+		&integerMessage1,
+		&integerMessage1,
+		&incrementType{TemplateID: 7, SeqNum: 7},
+		&incrementType{TemplateID: 7, SeqNum: 8},
+	}
+	for _, e := range expect {
+		msg := reflect.New(reflect.TypeOf(e).Elem()).Interface()
+		if err := dec.Decode(msg); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if !reflect.DeepEqual(msg, e) {
+			t.Fatal("messages is not equal, got: ", msg, ", expect: ", e)
+		}
+	}
+
+	if buf.Len() > 0 {
+		t.Fatal("buffer is not empty")
+	}
+
+	dec.Reset()
+	buf.Write([]byte{0x80})
+	if err := dec.Decode(&incrementType{}); err != fast.ErrD5 {
+		t.Fatal("not found err: '", fast.ErrD5, "' got '", err, "'")
+	}
+}
+
+func TestMergeDecode(t *testing.T) {
+	// integer message with absent OptionalUint32 and OptionalInt32
+	data := []byte{0xc0, 0x85, 0x83, 0x80, 0x25, 0x20, 0x2f, 0x47, 0xfe, 0x25, 0x20, 0x2f, 0x48, 0x80, 0x85, 0x80, 0x8, 0x23, 0x51, 0x57, 0x8d, 0x8, 0x23, 0x51, 0x57, 0x8f}
+
+	msg := integerMessage1
+	msg.MandatoryUint32 = 100
+	msg.OptionalUint32 = 40
+	msg.OptionalInt32 = 60
+
+	expect := integerMessage1
+	expect.OptionalUint32 = 40
+	expect.OptionalInt32 = 60
+
+	dec := fast.NewDecoder(bytes.NewBuffer(data), decoderTemplates(t)...)
+	dec.SetMerge(true)
+	if err := dec.Decode(&msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if msg != expect {
+		t.Fatal("messages is not equal, got: ", msg, ", expect: ", expect)
+	}
+
+	expect.OptionalUint32 = 0
+	expect.OptionalInt32 = 0
+
+	dec = fast.NewDecoder(bytes.NewBuffer(data), decoderTemplates(t)...)
+	if err := dec.Decode(&msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if msg != expect {
+		t.Fatal("messages is not equal, got: ", msg, ", expect: ", expect)
+	}
+}
+
+func TestEmbeddedDecode(t *testing.T) {
+	tpls := decoderTemplates(t)
+
+	inner := &bytes.Buffer{}
+	if err := fast.NewEncoder(inner, tpls...).Encode(&integerMessage1); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	outer := &bytes.Buffer{}
+	msg := byteVectorType{TemplateID: 3, MandatoryVector: inner.Bytes(), OptionalVector: []byte{0xb3}}
+	if err := fast.NewEncoder(outer, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	dec := fast.NewDecoder(outer, tpls...)
+	var outerMsg byteVectorType
+	if err := dec.Decode(&outerMsg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if !reflect.DeepEqual(outerMsg, msg) {
+		t.Fatal("messages is not equal, got: ", outerMsg, ", expect: ", msg)
+	}
+
+	var innerMsg integerType
+	if err := dec.DecodeEmbedded(outerMsg.MandatoryVector, nil, &innerMsg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if innerMsg != integerMessage1 {
+		t.Fatal("messages is not equal, got: ", innerMsg, ", expect: ", integerMessage1)
+	}
+}
+
+func TestMaxPmapBytes(t *testing.T) {
+	// integer message with absent OptionalUint32 and OptionalInt32
+	body := []byte{0x85, 0x83, 0x80, 0x25, 0x20, 0x2f, 0x47, 0xfe, 0x25, 0x20, 0x2f, 0x48, 0x80, 0x85, 0x80, 0x8, 0x23, 0x51, 0x57, 0x8d, 0x8, 0x23, 0x51, 0x57, 0x8f}
+	pmaps := []struct {
+		data   []byte
+		expect int
+	}{
+		{[]byte{0xc0}, 1},
+		{[]byte{0x40, 0x00, 0x80}, 3},
+		{[]byte{0x40, 0x80}, 3},
+	}
+
+	buf := &bytes.Buffer{}
+	dec := fast.NewDecoder(buf, decoderTemplates(t)...)
+	if dec.MaxPmapBytes() != 0 {
+		t.Fatal("max pmap bytes is not zero before decoding")
+	}
+	for _, pmap := range pmaps {
+		buf.Write(pmap.data)
+		buf.Write(body)
+
+		var msg integerType
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if dec.MaxPmapBytes() != pmap.expect {
+			t.Fatal("max pmap bytes is", dec.MaxPmapBytes(), "expected", pmap.expect)
+		}
+	}
+}
+
+func TestExactDecimalDecode(t *testing.T) {
+	type exactDecimalType struct {
+		TemplateID           uint `fast:"*"`
+		CopyDecimal          decimal.Decimal
+		MandatoryDecimal     string
+		IndividualDecimal    float64
+		IndividualDecimalOpt *decimal.Decimal
+	}
+
+	tpls := decoderTemplates(t)
+	msg := exactDecimalType{
+		TemplateID:        1,
+		CopyDecimal:       decimal.New(150, -2),
+		MandatoryDecimal:  "2.500",
+		IndividualDecimal: 0.0032,
+	}
+	buf := &bytes.Buffer{}
+	err := fast.NewEncoder(buf, tpls...).Encode(&struct {
+		TemplateID        uint `fast:"*"`
+		CopyDecimal       decimal.Decimal
+		MandatoryDecimal  decimal.Decimal
+		IndividualDecimal    float64
+		IndividualDecimalOpt decimal.Decimal
+	}{1, msg.CopyDecimal, decimal.New(2500, -3), msg.IndividualDecimal, decimal.New(1110, -2)})
+	if err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	dec := fast.NewDecoder(buf, tpls...)
+	dec.SetExactDecimal(true)
+	var got exactDecimalType
+	if err = dec.Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+
+	if got.CopyDecimal.Exponent() != -2 || got.CopyDecimal.StringFixed(2) != "1.50" {
+		t.Fatal("scale of CopyDecimal is not preserved: ", got.CopyDecimal, got.CopyDecimal.Exponent())
+	}
+	if got.MandatoryDecimal != msg.MandatoryDecimal {
+		t.Fatal("wrong MandatoryDecimal: ", got.MandatoryDecimal, ", expect: ", msg.MandatoryDecimal)
+	}
+	if got.IndividualDecimal != msg.IndividualDecimal {
+		t.Fatal("wrong IndividualDecimal: ", got.IndividualDecimal, ", expect: ", msg.IndividualDecimal)
+	}
+	if got.IndividualDecimalOpt == nil || got.IndividualDecimalOpt.Exponent() != -2 {
+		t.Fatal("scale of IndividualDecimalOpt is not preserved: ", got.IndividualDecimalOpt)
+	}
+}
+
+func TestExactDecimalInitialDecode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="DecimalInitial" id="1">
+		<decimal name="DefaultPx" id="1"><default value="1.50"/></decimal>
+		<decimal name="CopyPx" id="2"><copy value="2.5"/></decimal>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type exactType struct {
+		TemplateID uint `fast:"*"`
+		DefaultPx  decimal.Decimal
+		CopyPx     string
+	}
+	type floatType struct {
+		TemplateID uint `fast:"*"`
+		DefaultPx  float64
+		CopyPx     float64
+	}
+
+	// bits of DefaultPx and CopyPx are clear
+	data := []byte{0xc0, 0x81}
+
+	dec := fast.NewDecoder(bytes.NewReader(data), tpls...)
+	dec.SetExactDecimal(true)
+	var exact exactType
+	if err = dec.Decode(&exact); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if exact.DefaultPx.Coefficient().Int64() != 150 || exact.DefaultPx.Exponent() != -2 || exact.CopyPx != "2.5" {
+		t.Fatal("wrong initial values: ", exact.DefaultPx, exact.CopyPx)
+	}
+
+	var float floatType
+	if err = fast.NewDecoder(bytes.NewReader(data), tpls...).Decode(&float); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if float.DefaultPx != 1.5 || float.CopyPx != 2.5 {
+		t.Fatal("wrong initial values: ", float.DefaultPx, float.CopyPx)
+	}
+}
+
+func TestFloatDecimalDecode(t *testing.T) {
+	type decimalFieldType struct {
+		TemplateID           uint `fast:"*"`
+		CopyDecimal          decimal.Decimal
+		MandatoryDecimal     decimal.Decimal
+		IndividualDecimal    decimal.Decimal
+		IndividualDecimalOpt *decimal.Decimal
+	}
+
+	var msg decimalFieldType
+	if err := fast.NewDecoder(bytes.NewReader(decimalData1), decoderTemplates(t)...).Decode(&msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+
+	expect := []decimal.Decimal{
+		decimal.NewFromFloat(decimalMessage1.CopyDecimal),
+		decimal.NewFromFloat(decimalMessage1.MandatoryDecimal),
+		decimal.NewFromFloat(decimalMessage1.IndividualDecimal),
+		decimal.NewFromFloat(decimalMessage1.IndividualDecimalOpt),
+	}
+	if msg.IndividualDecimalOpt == nil {
+		t.Fatal("IndividualDecimalOpt is not decoded")
+	}
+	got := []decimal.Decimal{msg.CopyDecimal, msg.MandatoryDecimal, msg.IndividualDecimal, *msg.IndividualDecimalOpt}
+	for i := range expect {
+		if !got[i].Equal(expect[i]) {
+			t.Fatal("decimal is not equal, got: ", got[i], ", expect: ", expect[i])
+		}
+	}
+}
+
+func TestDecodeRewrite(t *testing.T) {
+	statuses := map[uint32]uint32{3: 30, 4: 40}
+	dec := fast.NewDecoder(bytes.NewBuffer(integerData1), decoderTemplates(t)...)
+	dec.SetDecodeRewrite(5, "MandatoryUint32", func(value interface{}) interface{} {
+		return statuses[value.(uint32)]
+	})
+	dec.SetDecodeRewrite(5, "OptionalUint32", func(value interface{}) interface{} {
+		return statuses[value.(uint32)]
+	})
+	dec.SetDecodeRewrite(6, "MandatoryInt32", func(value interface{}) interface{} {
+		return int32(0)
+	})
+	dec.SetDecodeRewrite(5, "OptionalUint32", nil)
+
+	var msg integerType
+	if err := dec.Decode(&msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+
+	expect := integerMessage1
+	expect.MandatoryUint32 = 30
+	if msg != expect {
+		t.Fatal("messages is not equal, got: ", msg, ", expect: ", expect)
+	}
+}
+
+func TestMaxDepthDecode(t *testing.T) {
+	dec := fast.NewDecoder(bytes.NewBuffer(nestedGroupData1), decoderTemplates(t)...)
+	dec.SetMaxDepth(1)
+
+	var msg nestedGroupType
+	if err := dec.Decode(&msg); err != fast.ErrMaxDepth {
+		t.Fatal("not found err: '", fast.ErrMaxDepth, "' got '", err, "'")
+	}
+
+	dec = fast.NewDecoder(bytes.NewBuffer(nestedGroupData1), decoderTemplates(t)...)
+	dec.SetMaxDepth(2)
+	if err := dec.Decode(&msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if msg != nestedGroupMessage1 {
+		t.Fatal("messages is not equal, got: ", msg, ", expect: ", nestedGroupMessage1)
+	}
+}
+
+func TestUnicodeBytesDecode(t *testing.T) {
+	type unicodeBytesType struct {
+		TemplateID       uint `fast:"*"`
+		MandatoryAscii   string
+		OptionalAscii    string
+		MandatoryUnicode []byte
+		OptionalUnicode  []byte
+	}
+
+	tpls := decoderTemplates(t)
+	msg := unicodeBytesType{
+		TemplateID:       4,
+		MandatoryAscii:   "abc",
+		OptionalAscii:    "d",
+		MandatoryUnicode: []byte("цена"),
+		OptionalUnicode:  []byte("€"),
+	}
+
+	buf := &bytes.Buffer{}
+	if err := fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+
+	var got unicodeBytesType
+	if err := fast.NewDecoder(buf, tpls...).Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+	}
+
+	var str stringType
+	if err := fast.NewDecoder(bytes.NewBuffer(data), tpls...).Decode(&str); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if str.MandatoryUnicode != "цена" || str.OptionalUnicode != "€" {
+		t.Fatal("wrong unicode strings: ", str.MandatoryUnicode, str.OptionalUnicode)
+	}
+
+	msg.MandatoryUnicode = []byte{0xff, 0xfe}
+	if err := fast.NewEncoder(&bytes.Buffer{}, tpls...).Encode(&msg); err != fast.ErrR2 {
+		t.Fatal("not found err: '", fast.ErrR2, "' got '", err, "'")
+	}
+}
+
+func TestUnicodeBytesCopyDecode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="UnicodeCopy" id="1">
+		<string name="Name" id="1" charset="unicode"><copy/></string>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type bytesType struct {
+		TemplateID uint `fast:"*"`
+		Name       []byte
+	}
+	type stringType struct {
+		TemplateID uint `fast:"*"`
+		Name       string
+	}
+
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	if err = enc.Encode(&bytesType{1, []byte("цена")}); err != nil {
+		t.Fatal("can not encode", err)
+	}
+	// []byte and string values are equal for copy operator
+	size := buf.Len()
+	if err = enc.Encode(&stringType{1, "цена"}); err != nil {
+		t.Fatal("can not encode", err)
+	}
+	if data := buf.Bytes()[size:]; !bytes.Equal(data, []byte{0xc0, 0x81}) {
+		t.Fatalf("data is not equal. current: %x expected: %x", data, []byte{0xc0, 0x81})
+	}
+	if err = enc.Encode(&bytesType{1, []byte("цена")}); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	dec := fast.NewDecoder(buf, tpls...)
+	var first bytesType
+	if err = dec.Decode(&first); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	var second stringType
+	if err = dec.Decode(&second); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	var third bytesType
+	if err = dec.Decode(&third); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if string(first.Name) != "цена" || second.Name != "цена" || string(third.Name) != "цена" {
+		t.Fatal("wrong unicode strings: ", first.Name, second.Name, third.Name)
+	}
+}
+
+func TestDecodeTrace(t *testing.T) {
+	tpls := decoderTemplates(t)
+
+	var msg decimalType
+	trace, err := fast.NewDecoder(bytes.NewBuffer(decimalData1), tpls...).DecodeTrace(&msg)
+	if err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if msg != decimalMessage1 {
+		t.Fatal("messages is not equal, got: ", msg, ", expect: ", decimalMessage1)
+	}
+
+	expect := "*:copy=1 CopyDecimal:copy=1 MandatoryDecimal:none= IndividualDecimal.exponent:default=1 " +
+		"IndividualDecimal.mantissa:delta= IndividualDecimalOpt.exponent:default=1 IndividualDecimalOpt.mantissa:delta="
+	if trace.String() != expect {
+		t.Fatalf("trace is not equal. current: %s expected: %s", trace, expect)
+	}
+
+	// mantissa is not read for absent decimal
+	absent, err := fast.NewDecoder(bytes.NewBuffer(decimalData2), tpls...).DecodeTrace(&decimalType{})
+	if err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if suffix := "IndividualDecimalOpt.exponent:default=1"; !strings.HasSuffix(absent.String(), suffix) {
+		t.Fatalf("trace is not equal. current: %s expected suffix: %s", absent, suffix)
+	}
+
+	replay, err := fast.NewDecoder(bytes.NewBuffer(decimalData1), tpls...).DecodeTrace(&decimalType{})
+	if err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if err = replay.Verify(trace); err != nil {
+		t.Fatal("trace is not replayed", err)
+	}
+
+	group, err := fast.NewDecoder(bytes.NewBuffer(groupData1), tpls...).DecodeTrace(&groupType{})
+	if err != nil {
+		t.Fatal("can not decode", err)
+	}
+	expect = "*:copy=1 TestData:none= OuterTestData:none= InnerGroup:none=1 InnerTestData:none="
+	if group.String() != expect {
+		t.Fatalf("trace is not equal. current: %s expected: %s", group, expect)
+	}
+	if err = group.Verify(trace); !errors.Is(err, fast.ErrTraceMismatch) {
+		t.Fatal("not found err: '", fast.ErrTraceMismatch, "' got '", err, "'")
+	}
+}
+
+func TestRestDecode(t *testing.T) {
+	type restType struct {
+		TemplateID      uint `fast:"*"`
+		MandatoryUint32 uint32
+		OptionalUint32  uint32
+		MandatoryUint64 uint64
+		OptionalUint64  uint64
+		MandatoryInt32  int32
+		OptionalInt32   int32
+		MandatoryInt64  int64
+		OptionalInt64   int64
+		Rest            []byte `fast:",rest"`
+	}
+
+	tpls := decoderTemplates(t)
+	trailing := []byte{0x81, 0x00, 0x82}
+	data := append(append([]byte(nil), integerData1...), trailing...)
+
+	var msg restType
+	err := fast.NewDecoder(bytes.NewReader(data), tpls...).Decode(&msg)
+	if err != fast.ErrUnboundedRest {
+		t.Fatal("not found err: '", fast.ErrUnboundedRest, "' got '", err, "'")
+	}
+
+	msg = restType{}
+	if err = fast.NewDecoder(nil, tpls...).DecodeEmbedded(data, nil, &msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if msg.MandatoryInt64 != integerMessage1.MandatoryInt64 || msg.OptionalInt64 != integerMessage1.OptionalInt64 {
+		t.Fatal("wrong message: ", msg)
+	}
+	if !bytes.Equal(msg.Rest, trailing) {
+		t.Fatalf("rest is not equal. current: %x expected: %x", msg.Rest, trailing)
+	}
+
+	msg = restType{}
+	if err = fast.NewDecoder(nil, tpls...).DecodeEmbedded(integerData1, nil, &msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if msg.Rest != nil {
+		t.Fatalf("rest is not empty: %x", msg.Rest)
+	}
+
+	buf := &bytes.Buffer{}
+	enc, err := fast.NewCaptureEncoder(buf, tpls...)
+	if err != nil {
+		t.Fatal("can not create encoder", err)
+	}
+	if err = enc.Encode(&integerMessage1); err != nil {
+		t.Fatal("can not encode", err)
+	}
+	// append trailing bytes to the record
+	record := buf.Bytes()[5:]
+	record[3] += byte(len(trailing))
+	buf.Write(trailing)
+	if err = enc.Encode(&integerMessage1); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	dec, err := fast.NewCaptureDecoder(buf, tpls...)
+	if err != nil {
+		t.Fatal("can not create decoder", err)
+	}
+	for i, expect := range [][]byte{trailing, nil} {
+		msg = restType{}
+		fields, err := dec.DecodeRaw(&msg)
+		if err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if !bytes.Equal(msg.Rest, expect) {
+			t.Fatalf("message %d: rest is not equal. current: %x expected: %x", i, msg.Rest, expect)
+		}
+
+		var raw []byte
+		for _, field := range fields {
+			raw = append(raw, field.Data...)
+		}
+		data := append(append([]byte(nil), integerData1...), expect...)
+		if !bytes.Equal(raw, data) {
+			t.Fatalf("message %d: raw data is not equal. current: %x expected: %x", i, raw, data)
+		}
+	}
+}
+
+func TestResetDecode(t *testing.T) {
+	// sequence with stale elements beyond the decoded length
+	stale := sequenceMessage1.OuterSequence[0]
+	outer := append(sequenceMessage1.OuterSequence[:0:0], stale, stale, stale)
+
+	msg := sequenceType{OuterSequence: outer}
+	dec := fast.NewDecoder(bytes.NewBuffer(sequenceData1), decoderTemplates(t)...)
+	if err := dec.Decode(&msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if !reflect.DeepEqual(msg, sequenceMessage1) {
+		t.Fatal("messages is not equal, got: ", msg, ", expect: ", sequenceMessage1)
+	}
+
+	if cap(msg.OuterSequence) != cap(outer) || &msg.OuterSequence[0] != &outer[0] {
+		t.Fatal("capacity of sequence is not reused")
+	}
+	for i, elem := range outer[len(msg.OuterSequence):] {
+		if elem != nil {
+			t.Fatalf("element %d is not reset: %v", i+len(msg.OuterSequence), elem)
+		}
+	}
+}
+
+func decoderTemplates(t *testing.T) []*fast.Template {
+	ftpl, err := os.Open("testdata/test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftpl.Close()
+
+	tpls, err := fast.ParseXMLTemplate(ftpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tpls
+}
+
+func TestNestedGroupDecode(t *testing.T) {
+	var msg nestedGroupType
+	decode(nestedGroupData1, &msg, &nestedGroupMessage1, t)
+}
+
 // write profile command: go test -bench=BenchmarkDecoder_DecodeReflection -cpuprofile=cpu.out -memprofile=mem.out
 // convert to cpuprof.pdf command: go tool pprof -pdf -output=cpuprof.pdf goFAST.test cpu.out
 // convert to memprof.pdf command: go tool pprof -pdf -output=memprof.pdf goFAST.test mem.out
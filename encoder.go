@@ -6,10 +6,16 @@ package fast
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
 	"sync"
+	"unicode/utf8"
 )
 
+// ErrPMapOverflow is returned if a segment of message requires more than 63 bits of presence map.
+var ErrPMapOverflow = errors.New("encoder: presence map exceeds 63 bits")
+
 // A Encoder encodes and writes data to io.Writer.
 type Encoder struct {
 	repo map[uint]Template
@@ -24,6 +30,10 @@ type Encoder struct {
 	msg Sender
 
 	target io.Writer
+	capture bool // write message as length-prefixed record
+	normalize bool // normalize decimals before encoding
+	normalized map[uint]Template // templates with normalized initial values of decimals
+	onEncoded func(in *Instruction, transmitted bool, value interface{})
 
 	logger *writerLog
 	mu sync.Mutex
@@ -33,7 +43,7 @@ type Encoder struct {
 func (e *Encoder) Reset() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.storage = newStorage()
+	e.storage.clear()
 }
 
 // NewEncoder returns a new encoder that writes FAST-encoded message to writer.
@@ -50,6 +60,26 @@ func NewEncoder(writer io.Writer, tmps ...*Template) *Encoder {
 	return encoder
 }
 
+// SetNormalize sets normalization of decimal.Decimal and float64 values. If it
+// is enabled, trailing zeros of mantissa of values and initial values of
+// instructions are removed before encoding, so numerically equal decimals like
+// 1.50 and 1.5 are compressed by copy and default operators.
+func (e *Encoder) SetNormalize(normalize bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.normalize = normalize
+}
+
+// OnEncodedField sets fn to be called after every field is encoded. The
+// transmitted flag reports whether the field is present in the stream, i.e. its
+// bit of presence map is set or its value is written, or it is implied by the
+// operator of instruction and the dictionary. Nil fn removes hook.
+func (e *Encoder) OnEncodedField(fn func(in *Instruction, transmitted bool, value interface{})) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onEncoded = fn
+}
+
 // SetLog sets writer for logging
 func (e *Encoder) SetLog(writer io.Writer) {
 	e.mu.Lock()
@@ -67,6 +97,9 @@ func (e *Encoder) SetLog(writer io.Writer) {
 
 // Encode encodes msg struct to writer. If an encountered value implements the Sender interface
 // and is not a nil pointer, Encode calls method of Sender to produce encoded message.
+// Otherwise, if the value implements the FieldProvider interface or it is
+// map[string]interface{}, Encode gets values of fields by name. Absent optional
+// field is encoded as null and absent mandatory field returns ErrMissingField.
 func (e *Encoder) Encode(msg interface{}) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -83,7 +116,11 @@ func (e *Encoder) Encode(msg interface{}) error {
 
 	var ok bool
 	if e.msg, ok = msg.(Sender); !ok {
-		e.msg = makeMsg(msg)
+		if p, ok := providerOf(msg); ok {
+			e.msg = newProvider(p)
+		} else {
+			e.msg = makeMsg(msg)
+		}
 	}
 	e.tid = e.msg.GetTemplateID()
 
@@ -92,6 +129,9 @@ func (e *Encoder) Encode(msg interface{}) error {
 	if !ok {
 		return ErrD9
 	}
+	if e.normalize {
+		tpl = e.normalizedTemplate(tpl)
+	}
 
 	e.pmc.append(&pMap{mask: defaultMask})
 	e.addWriter()
@@ -106,6 +146,19 @@ func (e *Encoder) Encode(msg interface{}) error {
 	return e.commit()
 }
 
+// normalizedTemplate returns copy of tpl with normalized initial values of decimals.
+func (e *Encoder) normalizedTemplate(tpl Template) Template {
+	if res, ok := e.normalized[tpl.ID]; ok {
+		return res
+	}
+	if e.normalized == nil {
+		e.normalized = make(map[uint]Template)
+	}
+	tpl.Instructions = normalizeInstructions(tpl.Instructions)
+	e.normalized[tpl.ID] = tpl
+	return tpl
+}
+
 func (e *Encoder) addWriter() {
 	if e.logger != nil {
 		e.writers = append(e.writers, newWriter(wrapWriterLog(e.logger.log), wrapWriterLog(e.logger.log)))
@@ -126,6 +179,12 @@ func (e *Encoder) delWriterTo(index int) {
 }
 
 func (e *Encoder) commit() error {
+	if e.capture {
+		buf := &bytes.Buffer{}
+		e.writers[e.writerIndex].WriteTo(buf)
+		return writeRecord(e.target, buf.Bytes())
+	}
+
 	// TODO have to check err
 	e.writers[e.writerIndex].WriteTo(e.target)
 	return nil
@@ -153,16 +212,50 @@ func (e *Encoder) encodeSegment(instructions []*Instruction) error {
 			field := acquireField()
 			field.ID = instruction.ID
 			field.Name = instruction.Name
+			field.typ = instruction.Type
 
 			e.msg.GetValue(field)
+			if m, ok := e.msg.(*reflector); ok && m.err != nil {
+				releaseField(field)
+				return m.err
+			}
+			if p, ok := e.msg.(*provider); ok && field.Value == nil {
+				if err = p.missing(instruction); err != nil {
+					releaseField(field)
+					return err
+				}
+			}
+			switch value := field.Value.(type) {
+			case json.Number:
+				field.Value, err = instruction.fromJSONNumber(value)
+			case []byte:
+				if instruction.Type == TypeUnicodeString && !utf8.Valid(value) {
+					err = ErrR2
+				}
+			}
+			if err != nil {
+				releaseField(field)
+				return err
+			}
+			if e.normalize && instruction.Type == TypeDecimal {
+				field.Value = normalizeDecimal(field.Value)
+			}
 			e.log(instruction.Name, " = ", field.Value)
 			e.log("  encoding -> ")
+			size := len(e.writers[e.writerIndex].dataBuf.Bytes())
+			bitmap := e.pmc.active().bitmap
 			err = instruction.inject(
 				e.writers[e.writerIndex],
 				e.storage,
 				e.pmc.active(),
 				field.Value,
 			)
+			if err == nil && e.onEncoded != nil {
+				// presence of operator with pmap bit is decided by the bit
+				transmitted := e.pmc.active().bitmap != bitmap ||
+					!instruction.hasPmapBit() && len(e.writers[e.writerIndex].dataBuf.Bytes()) > size
+				e.onEncoded(instruction, transmitted, field.Value)
+			}
 			releaseField(field)
 		}
 
@@ -174,7 +267,7 @@ func (e *Encoder) encodeSegment(instructions []*Instruction) error {
 	e.log("  encoding -> ")
 
 	if m := e.pmc.current(); m != nil {
-		_ = e.writers[e.writerIndex].WritePMap(m)
+		return e.writers[e.writerIndex].WritePMap(m)
 	}
 
 	return nil
@@ -186,6 +279,17 @@ func (e *Encoder) encodeGroup(instruction *Instruction) error {
 	parent.ID = instruction.ID
 	parent.Name = instruction.Name
 
+	locked := e.msg.Lock(parent)
+	if p, ok := e.msg.(*provider); ok && !locked {
+		// group is absent
+		releaseField(parent)
+		if err := p.missing(instruction); err != nil {
+			return err
+		}
+		e.pmc.active().SetNextBit(false)
+		return nil
+	}
+
 	if instruction.isOptional() {
 		e.pmc.active().SetNextBit(true)
 	}
@@ -200,12 +304,13 @@ func (e *Encoder) encodeGroup(instruction *Instruction) error {
 	e.pmc.append(pmap)
 	e.addWriter()
 
-	e.msg.Lock(parent)
 	err := e.encodeSegment(instruction.Instructions)
 	if err != nil {
 		return err
 	}
-	e.msg.Unlock()
+	if locked {
+		e.msg.Unlock()
+	}
 	releaseField(parent)
 
 	e.pmc.restore()
@@ -219,6 +324,13 @@ func (e *Encoder) encodeSequence(instruction *Instruction) error {
 	parent.ID = instruction.ID
 	parent.Name = instruction.Name
 
+	if p, ok := e.msg.(*provider); ok && !p.has(parent.Name) {
+		if err := p.missing(instruction); err != nil {
+			releaseField(parent)
+			return err
+		}
+	}
+
 	e.msg.GetLength(parent)
 	length := parent.Value.(int)
 
@@ -248,12 +360,14 @@ func (e *Encoder) encodeSequence(instruction *Instruction) error {
 		e.pmc.append(pmap)
 		e.addWriter()
 
-		e.msg.Lock(parent)
+		locked := e.msg.Lock(parent)
 		err = e.encodeSegment(instruction.Instructions[1:])
 		if err != nil {
 			return err
 		}
-		e.msg.Unlock()
+		if locked {
+			e.msg.Unlock()
+		}
 		e.pmc.restore()
 		e.delWriterTo(current)
 	}
@@ -6,9 +6,15 @@ package fast_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/co11ter/goFAST"
+	"github.com/shopspring/decimal"
+	"math"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -67,4 +73,974 @@ func TestIntegerEncode(t *testing.T) {
 
 func TestGroupEncode(t *testing.T) {
 	encode(&groupMessage1, groupData1, t)
-}
\ No newline at end of file
+}
+
+func TestNestedGroupEncode(t *testing.T) {
+	encode(&nestedGroupMessage1, nestedGroupData1, t)
+}
+
+func TestFlatGroupEncode(t *testing.T) {
+	// message without struct fields of groups
+	type flatGroupType struct {
+		TemplateID    uint `fast:"*"`
+		TestData      uint32
+		OuterTestData uint32
+		InnerTestData uint32
+	}
+	msg := flatGroupType{TemplateID: 6, TestData: 1, OuterTestData: 2, InnerTestData: 3}
+
+	tpls := decoderTemplates(t)
+	buf := &bytes.Buffer{}
+	if err := fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+	if !bytes.Equal(buf.Bytes(), groupData1) {
+		t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), groupData1)
+	}
+
+	var got flatGroupType
+	if err := fast.NewDecoder(buf, tpls...).Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if got != msg {
+		t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+	}
+}
+
+func TestIncrementEncode(t *testing.T) {
+	tpls := decoderTemplates(t)
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	dec := fast.NewDecoder(buf, tpls...)
+
+	expect := [][]byte{
+		{0xe0, 0x87, 0x81},
+		{0xc0, 0x87},
+		{0xc0, 0x87},
+	}
+	for i, data := range expect {
+		msg := incrementType{TemplateID: 7, SeqNum: uint32(i + 1)}
+		if err := enc.Encode(&msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), data)
+		}
+
+		var got incrementType
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if got != msg {
+			t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+		}
+	}
+}
+
+func TestDecimalRoundingEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Rounding" id="1">
+		<decimal name="HalfUp" id="1" rounding="halfUp">
+			<exponent><constant value="-2"/></exponent>
+			<mantissa/>
+		</decimal>
+		<decimal name="HalfEven" id="2" rounding="halfEven">
+			<exponent><constant value="-2"/></exponent>
+			<mantissa/>
+		</decimal>
+		<decimal name="Down" id="3" rounding="down">
+			<exponent><constant value="-2"/></exponent>
+			<mantissa/>
+		</decimal>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type roundingType struct {
+		TemplateID uint `fast:"*"`
+		HalfUp     float64
+		HalfEven   float64
+		Down       float64
+	}
+
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	err = enc.Encode(&roundingType{TemplateID: 1, HalfUp: 1.005, HalfEven: 1.005, Down: 1.009})
+	if err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	// mantissas are 101, 100 and 100
+	expect := []byte{0xc0, 0x81, 0x00, 0xe5, 0x00, 0xe4, 0x00, 0xe4}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), expect)
+	}
+
+	var msg roundingType
+	if err = fast.NewDecoder(buf, tpls...).Decode(&msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if msg != (roundingType{TemplateID: 1, HalfUp: 1.01, HalfEven: 1, Down: 1}) {
+		t.Fatal("wrong rounded message: ", msg)
+	}
+}
+
+func TestStringDeltaEncode(t *testing.T) {
+	tpls := decoderTemplates(t)
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	dec := fast.NewDecoder(buf, tpls...)
+
+	abc, abd, xabd := "abc", "abd", "xabd"
+	cases := []struct {
+		value *string
+		data  []byte
+	}{
+		{nil, []byte{0xc0, 0x89, 0x80}},
+		{&abc, []byte{0xc0, 0x89, 0x81, 0x61, 0x62, 0xe3}},
+		{&abd, []byte{0xc0, 0x89, 0x82, 0xe4}},
+		{&xabd, []byte{0xc0, 0x89, 0xff, 0xf8}},
+	}
+	for _, c := range cases {
+		msg := stringDeltaType{TemplateID: 9, OptionalDelta: c.value}
+		if err := enc.Encode(&msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), c.data) {
+			t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), c.data)
+		}
+
+		var got stringDeltaType
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+		}
+	}
+}
+
+type fieldMap map[string]interface{}
+
+func (m fieldMap) FASTField(name string) (interface{}, bool) {
+	value, ok := m[name]
+	return value, ok
+}
+
+func TestFieldProviderEncode(t *testing.T) {
+	integers := fieldMap{
+		"*":               uint(5),
+		"MandatoryUint32": uint32(3),
+		"OptionalUint32":  uint32(4),
+		"MandatoryUint64": uint64(9999999998),
+		"OptionalUint64":  uint64(9999999999),
+		"MandatoryInt32":  int32(5),
+		"OptionalInt32":   int32(6),
+		"MandatoryInt64":  int64(2222222221),
+		"OptionalInt64":   int64(2222222222),
+	}
+	encode(integers, integerData1, t)
+
+	group := fieldMap{
+		"*":        uint(6),
+		"TestData": uint32(1),
+		"OuterGroup": fieldMap{
+			"OuterTestData": uint32(2),
+			"InnerGroup":    fieldMap{"InnerTestData": uint32(3)},
+		},
+	}
+	encode(group, groupData1, t)
+
+	sequence := fieldMap{
+		"*":        uint(2),
+		"TestData": uint32(1),
+		"OuterSequence": []fast.FieldProvider{
+			fieldMap{
+				"OuterTestData": uint32(2),
+				"InnerSequence": []fast.FieldProvider{
+					fieldMap{"InnerTestData": uint32(3)},
+					fieldMap{"InnerTestData": uint32(4)},
+				},
+			},
+		},
+		"NextOuterSequence": []fast.FieldProvider{
+			fieldMap{"NextOuterTestData": uint32(2)},
+		},
+	}
+	encode(sequence, sequenceData1, t)
+}
+
+func TestMapEncode(t *testing.T) {
+	integers := map[string]interface{}{
+		"*":               uint(5),
+		"MandatoryUint32": uint32(3),
+		"MandatoryUint64": uint64(9999999998),
+		"OptionalUint64":  uint64(9999999999),
+		"MandatoryInt32":  int32(5),
+		"MandatoryInt64":  int64(2222222221),
+		"OptionalInt64":   int64(2222222222),
+	}
+
+	// OptionalUint32 and OptionalInt32 are absent
+	expect := []byte{0xc0, 0x85, 0x83, 0x80, 0x25, 0x20, 0x2f, 0x47, 0xfe, 0x25, 0x20, 0x2f, 0x48, 0x80, 0x85, 0x80, 0x8, 0x23, 0x51, 0x57, 0x8d, 0x8, 0x23, 0x51, 0x57, 0x8f}
+	encode(integers, expect, t)
+
+	sequence := map[string]interface{}{
+		"*":        uint(2),
+		"TestData": uint32(1),
+		"OuterSequence": []interface{}{
+			map[string]interface{}{
+				"OuterTestData": uint32(2),
+				"InnerSequence": []map[string]interface{}{
+					{"InnerTestData": uint32(3)},
+					{"InnerTestData": uint32(4)},
+				},
+			},
+		},
+		"NextOuterSequence": []map[string]interface{}{
+			{"NextOuterTestData": uint32(2)},
+		},
+	}
+	encode(sequence, sequenceData1, t)
+
+	// optional InnerGroup is absent
+	group := map[string]interface{}{
+		"*":          uint(6),
+		"TestData":   uint32(1),
+		"OuterGroup": map[string]interface{}{"OuterTestData": uint32(2)},
+	}
+	encode(group, []byte{0xc0, 0x86, 0x81, 0x82}, t)
+
+	delete(integers, "MandatoryInt32")
+	err := fast.NewEncoder(&bytes.Buffer{}, decoderTemplates(t)...).Encode(integers)
+	if !errors.Is(err, fast.ErrMissingField) {
+		t.Fatal("not found err: '", fast.ErrMissingField, "' got '", err, "'")
+	}
+
+	// mandatory group Outer is absent
+	err = fast.NewEncoder(&bytes.Buffer{}, decoderTemplates(t)...).Encode(map[string]interface{}{"*": 8, "Value": uint32(7)})
+	if !errors.Is(err, fast.ErrMissingField) {
+		t.Fatal("not found err: '", fast.ErrMissingField, "' got '", err, "'")
+	}
+
+	// mandatory sequence NextOuterSequence is absent
+	delete(sequence, "NextOuterSequence")
+	err = fast.NewEncoder(&bytes.Buffer{}, decoderTemplates(t)...).Encode(sequence)
+	if !errors.Is(err, fast.ErrMissingField) {
+		t.Fatal("not found err: '", fast.ErrMissingField, "' got '", err, "'")
+	}
+}
+
+func TestJSONNumberEncode(t *testing.T) {
+	encoder.Reset()
+	defer encoder.Reset()
+	integers := fieldMap{
+		"*":               json.Number("5"),
+		"MandatoryUint32": json.Number("3"),
+		"OptionalUint32":  json.Number("4"),
+		"MandatoryUint64": json.Number("9999999998"),
+		"OptionalUint64":  json.Number("9999999999"),
+		"MandatoryInt32":  json.Number("5"),
+		"OptionalInt32":   json.Number("6"),
+		"MandatoryInt64":  json.Number("2222222221"),
+		"OptionalInt64":   json.Number("2222222222"),
+	}
+	encode(integers, integerData1, t)
+
+	decimals := fieldMap{
+		"*":                    json.Number("1"),
+		"CopyDecimal":          json.Number("5.15"),
+		"MandatoryDecimal":     json.Number("154.6"),
+		"IndividualDecimal":    json.Number("0.0032"),
+		"IndividualDecimalOpt": json.Number("11.1"),
+	}
+	encode(decimals, decimalData1, t)
+
+	errs := []struct {
+		name  string
+		value json.Number
+		err   error
+	}{
+		{"MandatoryUint32", "4294967296", fast.ErrR4},
+		{"MandatoryUint32", "-1", fast.ErrR4},
+		{"MandatoryInt32", "1.5", fast.ErrR5},
+		{"MandatoryInt32", "abc", fast.ErrD1},
+	}
+	for _, e := range errs {
+		msg := fieldMap{}
+		for k, v := range integers {
+			msg[k] = v
+		}
+		msg[e.name] = e.value
+
+		err := fast.NewEncoder(&bytes.Buffer{}, decoderTemplates(t)...).Encode(msg)
+		if err != e.err {
+			t.Fatal("not found err: '", e.err, "' got '", err, "'")
+		}
+	}
+}
+
+func TestDecimalNormalizeEncode(t *testing.T) {
+	type copyDecimalType struct {
+		TemplateID       uint `fast:"*"`
+		CopyDecimal          decimal.Decimal
+		MandatoryDecimal     float64
+		IndividualDecimal    float64
+		IndividualDecimalOpt float64
+	}
+
+	for _, normalize := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		enc := fast.NewEncoder(buf, decoderTemplates(t)...)
+		enc.SetNormalize(normalize)
+		dec := fast.NewDecoder(buf, decoderTemplates(t)...)
+
+		values := []decimal.Decimal{decimal.New(150, -2), decimal.New(15, -1)}
+		for i, value := range values {
+			err := enc.Encode(&copyDecimalType{TemplateID: 1, CopyDecimal: value, MandatoryDecimal: 2})
+			if err != nil {
+				t.Fatal("can not encode", err)
+			}
+
+			// the second bit of the presence map is the bit of CopyDecimal
+			transmitted := buf.Bytes()[0]&0x20 != 0
+			if expect := i == 0 || !normalize; transmitted != expect {
+				t.Fatalf("normalize %t, message %d: CopyDecimal transmitted %t, expect %t", normalize, i, transmitted, expect)
+			}
+
+			var msg decimalType
+			if err = dec.Decode(&msg); err != nil {
+				t.Fatal("can not decode", err)
+			}
+			if msg.CopyDecimal != 1.5 {
+				t.Fatal("wrong CopyDecimal: ", msg.CopyDecimal)
+			}
+		}
+	}
+}
+
+func TestDeltaDecimalReset(t *testing.T) {
+	tpls := decoderTemplates(t)
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	dec := fast.NewDecoder(buf, tpls...)
+
+	cases := []struct {
+		reset bool
+		msg   deltaDecimalType
+		data  []byte
+	}{
+		// deltas against zero and initial values -2 and 100
+		{false, deltaDecimalType{10, 1.25, 1.5}, []byte{0xc0, 0x8a, 0xfe, 0x00, 0xfd, 0x81, 0x7f, 0xab}},
+		// deltas against the previous values
+		{false, deltaDecimalType{10, 1.3, 1.75}, []byte{0xc0, 0x8a, 0x81, 0x7f, 0x90, 0xff, 0x01, 0xa0}},
+		// deltas against zero and initial values again
+		{true, deltaDecimalType{10, 1.25, 1.5}, []byte{0xc0, 0x8a, 0xfe, 0x00, 0xfd, 0x81, 0x7f, 0xab}},
+	}
+	for _, c := range cases {
+		if c.reset {
+			enc.Reset()
+			dec.Reset()
+		}
+
+		if err := enc.Encode(&c.msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), c.data) {
+			t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), c.data)
+		}
+
+		var msg deltaDecimalType
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if msg != c.msg {
+			t.Fatal("messages is not equal, got: ", msg, ", expect: ", c.msg)
+		}
+	}
+}
+
+func TestPMapEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="PMap" id="1">
+		<uInt32 name="F1" id="1"><copy/></uInt32>
+		<uInt32 name="F2" id="2"><copy/></uInt32>
+		<uInt32 name="F3" id="3"><copy/></uInt32>
+		<uInt32 name="F4" id="4"><copy/></uInt32>
+		<uInt32 name="F5" id="5"><copy/></uInt32>
+		<uInt32 name="F6" id="6"><copy/></uInt32>
+		<uInt32 name="F7" id="7"><copy/></uInt32>
+		<uInt32 name="F8" id="8"><copy/></uInt32>
+		<uInt32 name="F9" id="9"><copy/></uInt32>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type pmapType struct {
+		TemplateID                         uint `fast:"*"`
+		F1, F2, F3, F4, F5, F6, F7, F8, F9 uint32
+	}
+
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	dec := fast.NewDecoder(buf, tpls...)
+
+	cases := []struct {
+		msg  pmapType
+		pmap []byte
+	}{
+		// all bits are set: 1111111 111
+		{pmapType{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, []byte{0x7f, 0xf0}},
+		// template id and F9: 1000000 001, unused bits of the last byte are zero
+		{pmapType{1, 1, 1, 1, 1, 1, 1, 1, 1, 2}, []byte{0x40, 0x90}},
+		// template id only, trailing zero byte is not written: 1000000 000
+		{pmapType{1, 1, 1, 1, 1, 1, 1, 1, 1, 2}, []byte{0xc0}},
+		// template id and F6: 1000001 000
+		{pmapType{1, 1, 1, 1, 1, 1, 2, 1, 1, 2}, []byte{0xc1}},
+	}
+	for _, c := range cases {
+		if err = enc.Encode(&c.msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), c.pmap) {
+			t.Fatalf("pmap is not equal. current: %x expected: %x", buf.Bytes(), c.pmap)
+		}
+
+		var msg pmapType
+		if err = dec.Decode(&msg); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if msg != c.msg {
+			t.Fatal("messages is not equal, got: ", msg, ", expect: ", c.msg)
+		}
+	}
+}
+
+func TestBigEndianEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Mixed" id="1">
+		<uInt32 name="StopBit" id="1"/>
+		<uInt32 name="Fixed" id="2" encoding="bigEndian"/>
+		<int32 name="FixedSigned" id="3" encoding="bigEndian"/>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type mixedType struct {
+		TemplateID  uint `fast:"*"`
+		StopBit     uint32
+		Fixed       uint32
+		FixedSigned int32
+	}
+	msg := mixedType{TemplateID: 1, StopBit: 256, Fixed: 256, FixedSigned: -2}
+
+	buf := &bytes.Buffer{}
+	if err = fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	expect := []byte{0xc0, 0x81, 0x02, 0x80, 0x00, 0x00, 0x01, 0x00, 0xff, 0xff, 0xff, 0xfe}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), expect)
+	}
+
+	var got mixedType
+	if err = fast.NewDecoder(buf, tpls...).Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if got != msg {
+		t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+	}
+}
+
+func TestSplitDecimalEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="SplitDecimal" id="1">
+		<int32 name="PxScale" id="1"/>
+		<int64 name="PxMantissa" id="2"/>
+		<int64 name="SizeMantissa" id="3"/>
+		<int32 name="SizeScale" id="4"/>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type splitDecimalType struct {
+		TemplateID uint            `fast:"*"`
+		Price      float64         `fast:"PxMantissa,exponent=PxScale"`
+		Size       decimal.Decimal `fast:"SizeMantissa,exponent=SizeScale"`
+	}
+	msg := splitDecimalType{TemplateID: 1, Price: 154.6, Size: decimal.New(150, -2)}
+
+	buf := &bytes.Buffer{}
+	if err = fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	expect := []byte{0xc0, 0x81, 0xff, 0x0c, 0x8a, 0x01, 0x96, 0xfe}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), expect)
+	}
+
+	var got splitDecimalType
+	if err = fast.NewDecoder(buf, tpls...).Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if got.Price != msg.Price || got.Size.Coefficient().Int64() != 150 || got.Size.Exponent() != -2 {
+		t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+	}
+}
+
+func TestSplitDecimalPartTypeEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="SplitDecimal" id="1">
+		<int32 name="PxMantissa" id="1"/>
+		<int64 name="PxScale" id="2"/>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type splitDecimalType struct {
+		TemplateID uint            `fast:"*"`
+		Price      decimal.Decimal `fast:"PxMantissa,exponent=PxScale"`
+	}
+	msg := splitDecimalType{TemplateID: 1, Price: decimal.New(1546, -1)}
+
+	buf := &bytes.Buffer{}
+	if err = fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	expect := []byte{0xc0, 0x81, 0x0c, 0x8a, 0xff}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), expect)
+	}
+
+	var got splitDecimalType
+	if err = fast.NewDecoder(buf, tpls...).Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if !got.Price.Equal(msg.Price) {
+		t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+	}
+
+	msg.Price = decimal.New(math.MaxInt32+1, 0)
+	err = fast.NewEncoder(&bytes.Buffer{}, tpls...).Encode(&msg)
+	if err != fast.ErrR4 {
+		t.Fatal("not found err: '", fast.ErrR4, "' got '", err, "'")
+	}
+}
+
+func TestSplitDecimalIDEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="SplitDecimal" id="1">
+		<int32 name="PxScale" id="1"/>
+		<int64 name="PxMantissa" id="2"/>
+		<uInt32 name="Qty" id="3"/>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type splitDecimalType struct {
+		TemplateID uint            `fast:"*"`
+		Price      decimal.Decimal `fast:"2,exponent=1"`
+		Qty        uint32          `fast:"3"`
+	}
+	msg := splitDecimalType{TemplateID: 1, Price: decimal.New(1546, -1), Qty: 5}
+
+	buf := &bytes.Buffer{}
+	if err = fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	expect := []byte{0xc0, 0x81, 0xff, 0x0c, 0x8a, 0x85}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Fatalf("data is not equal. current: %x expected: %x", buf.Bytes(), expect)
+	}
+
+	var got splitDecimalType
+	if err = fast.NewDecoder(buf, tpls...).Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if !got.Price.Equal(msg.Price) || got.Qty != msg.Qty {
+		t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+	}
+}
+
+func TestOnEncodedField(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Quote" id="1">
+		<string name="Type" id="35"><constant value="X"/></string>
+		<string name="Symbol" id="55"><copy/></string>
+		<uInt32 name="SeqNum" id="34"><increment/></uInt32>
+		<uInt32 name="Side" id="54"><default value="1"/></uInt32>
+		<uInt32 name="Price" id="44"><copy/></uInt32>
+		<string name="Venue" id="30" presence="optional"><constant value="MOEX"/></string>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type quoteType struct {
+		TemplateID uint `fast:"*"`
+		Type       string
+		Symbol     string
+		SeqNum     uint32
+		Side       uint32
+		Price      uint32
+		Venue      *string
+	}
+	venue := "MOEX"
+
+	transmitted := make(map[string]bool)
+	enc := fast.NewEncoder(&bytes.Buffer{}, tpls...)
+	enc.OnEncodedField(func(in *fast.Instruction, ok bool, value interface{}) {
+		transmitted[in.Name] = ok
+	})
+
+	messages := []struct {
+		msg    quoteType
+		expect map[string]bool
+	}{
+		{
+			quoteType{1, "X", "ABC", 1, 1, 10, &venue},
+			map[string]bool{"Type": false, "Symbol": true, "SeqNum": true, "Side": false, "Price": true, "Venue": true},
+		},
+		{
+			quoteType{1, "X", "ABC", 2, 2, 11, nil},
+			map[string]bool{"Type": false, "Symbol": false, "SeqNum": false, "Side": true, "Price": true, "Venue": false},
+		},
+	}
+	for i, m := range messages {
+		if err = enc.Encode(&m.msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !reflect.DeepEqual(transmitted, m.expect) {
+			t.Fatalf("message %d: transmitted fields %v, expect %v", i, transmitted, m.expect)
+		}
+	}
+}
+
+func TestExponentDefaultMantissaDeltaEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Price" id="1">
+		<decimal name="Px" id="44">
+			<exponent><default value="-2"/></exponent>
+			<mantissa><delta/></mantissa>
+		</decimal>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type priceType struct {
+		TemplateID uint `fast:"*"`
+		Px         decimal.Decimal
+	}
+
+	messages := []struct {
+		px     decimal.Decimal
+		expect []byte
+	}{
+		{decimal.New(100, -2), []byte{0xc0, 0x81, 0x00, 0xe4}},
+		{decimal.New(105, -2), []byte{0xc0, 0x81, 0x85}},
+		{decimal.New(103, -2), []byte{0xc0, 0x81, 0xfe}},
+		{decimal.New(10300, -4), []byte{0xe0, 0x81, 0xfc, 0x00, 0x4f, 0xd5}},
+		{decimal.New(104, -2), []byte{0xc0, 0x81, 0x7f, 0x30, 0xac}},
+	}
+
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	dec := fast.NewDecoder(buf, tpls...)
+	dec.SetExactDecimal(true)
+	for i, m := range messages {
+		if err = enc.Encode(&priceType{TemplateID: 1, Px: m.px}); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), m.expect) {
+			t.Fatalf("message %d: data is not equal. current: %x expected: %x", i, buf.Bytes(), m.expect)
+		}
+
+		var got priceType
+		if err = dec.Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if got.Px.Coefficient().Int64() != m.px.Coefficient().Int64() || got.Px.Exponent() != m.px.Exponent() {
+			t.Fatalf("message %d: wrong Px %s, expect %s", i, got.Px, m.px)
+		}
+	}
+}
+
+func TestInt64BoundaryEncode(t *testing.T) {
+	tpls := decoderTemplates(t)
+
+	values := []int64{
+		1<<62 - 1, 1 << 62, 1<<62 + 1, math.MaxInt64 - 1, math.MaxInt64,
+		-1 << 62, -1<<62 - 1, math.MinInt64 + 1, math.MinInt64,
+	}
+	for _, value := range values {
+		msg := integerType{TemplateID: 5, MandatoryInt64: value, OptionalInt64: value}
+
+		buf := &bytes.Buffer{}
+		if err := fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+
+		var got integerType
+		if err := fast.NewDecoder(buf, tpls...).Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if got != msg {
+			t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+		}
+	}
+
+	// the most significant group of max int64 has sign bit, so overflow group is added
+	expect := []byte{0x00, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0xff}
+	buf := &bytes.Buffer{}
+	msg := integerType{TemplateID: 5, MandatoryInt64: math.MaxInt64}
+	if err := fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+	if data := buf.Bytes(); !bytes.Equal(data[len(data)-len(expect)-1:len(data)-1], expect) {
+		t.Fatalf("data is not equal. current: %x expected: %x", data, expect)
+	}
+}
+
+func TestIntegerDeltaEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="IntegerDelta" id="1">
+		<uInt32 name="Uint32Delta" id="1"><delta/></uInt32>
+		<int64 name="Int64Delta" id="2"><delta/></int64>
+		<uInt32 name="OptionalDelta" id="3" presence="optional"><delta/></uInt32>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type integerDeltaType struct {
+		TemplateID    uint `fast:"*"`
+		Uint32Delta   uint32
+		Int64Delta    int64
+		OptionalDelta *uint32
+	}
+
+	seven := uint32(7)
+	messages := []struct {
+		msg    integerDeltaType
+		expect []byte
+	}{
+		{integerDeltaType{1, 10, -5, nil}, []byte{0xc0, 0x81, 0x8a, 0xfb, 0x80}},
+		// negative delta of unsigned integer
+		{integerDeltaType{1, 5, 100, &seven}, []byte{0xc0, 0x81, 0xfb, 0x00, 0xe9, 0x88}},
+		{integerDeltaType{1, math.MaxUint32, -100, &seven}, []byte{0xc0, 0x81, 0x0f, 0x7f, 0x7f, 0x7f, 0xfa, 0x7e, 0xb8, 0x81}},
+	}
+
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	dec := fast.NewDecoder(buf, tpls...)
+	for i, m := range messages {
+		if err = enc.Encode(&m.msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), m.expect) {
+			t.Fatalf("message %d: data is not equal. current: %x expected: %x", i, buf.Bytes(), m.expect)
+		}
+
+		var got integerDeltaType
+		if err = dec.Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if !reflect.DeepEqual(got, m.msg) {
+			t.Fatal("messages is not equal, got: ", got, ", expect: ", m.msg)
+		}
+	}
+}
+
+func TestUint64DeltaEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Uint64Delta" id="1">
+		<uInt64 name="Uint64Delta" id="1"><delta/></uInt64>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type uint64DeltaType struct {
+		TemplateID  uint `fast:"*"`
+		Uint64Delta uint64
+	}
+
+	messages := []struct {
+		msg    uint64DeltaType
+		expect []byte
+	}{
+		{uint64DeltaType{1, math.MaxInt64}, []byte{0xc0, 0x81, 0x00, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0xff}},
+		{uint64DeltaType{1, 1<<63 + 100}, []byte{0xc0, 0x81, 0x00, 0xe5}},
+		{uint64DeltaType{1, 100}, []byte{0xc0, 0x81, 0x7f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80}},
+	}
+
+	buf := &bytes.Buffer{}
+	enc := fast.NewEncoder(buf, tpls...)
+	dec := fast.NewDecoder(buf, tpls...)
+	for i, m := range messages {
+		if err = enc.Encode(&m.msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), m.expect) {
+			t.Fatalf("message %d: data is not equal. current: %x expected: %x", i, buf.Bytes(), m.expect)
+		}
+
+		var got uint64DeltaType
+		if err = dec.Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if got != m.msg {
+			t.Fatal("messages is not equal, got: ", got, ", expect: ", m.msg)
+		}
+	}
+
+	// difference does not fit in int64
+	err = fast.NewEncoder(&bytes.Buffer{}, tpls...).Encode(&uint64DeltaType{1, math.MaxUint64})
+	if err != fast.ErrR4 {
+		t.Fatal("expected error", fast.ErrR4, "got", err)
+	}
+
+	// negative result of delta
+	var got uint64DeltaType
+	err = fast.NewDecoder(bytes.NewReader([]byte{0xc0, 0x81, 0xff}), tpls...).Decode(&got)
+	if err != fast.ErrR4 {
+		t.Fatal("expected error", fast.ErrR4, "got", err)
+	}
+}
+
+func TestDecimalDefaultEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="DecimalDefault" id="1">
+		<decimal name="Px" id="1"><default value="1.5"/></decimal>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type floatDefaultType struct {
+		TemplateID uint `fast:"*"`
+		Px         float64
+	}
+	type decimalDefaultType struct {
+		TemplateID uint `fast:"*"`
+		Px         decimal.Decimal
+	}
+
+	messages := []struct {
+		msg    interface{}
+		expect []byte
+	}{
+		{&floatDefaultType{1, 1.5}, []byte{0xc0, 0x81}},
+		{&decimalDefaultType{1, decimal.New(15, -1)}, []byte{0xc0, 0x81}},
+		{&decimalDefaultType{1, decimal.New(150, -2)}, []byte{0xe0, 0x81, 0xfe, 0x01, 0x96}},
+	}
+	for i, m := range messages {
+		buf := &bytes.Buffer{}
+		if err = fast.NewEncoder(buf, tpls...).Encode(m.msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), m.expect) {
+			t.Fatalf("message %d: data is not equal. current: %x expected: %x", i, buf.Bytes(), m.expect)
+		}
+	}
+}
+
+func TestNormalizeDefaultEncode(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="DecimalDefault" id="1">
+		<decimal name="Px" id="1"><default value="1.50"/></decimal>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type floatDefaultType struct {
+		TemplateID uint `fast:"*"`
+		Px         float64
+	}
+	type decimalDefaultType struct {
+		TemplateID uint `fast:"*"`
+		Px         decimal.Decimal
+	}
+
+	messages := []struct {
+		normalize bool
+		msg       interface{}
+		expect    []byte
+	}{
+		{true, &floatDefaultType{1, 1.5}, []byte{0xc0, 0x81}},
+		{true, &decimalDefaultType{1, decimal.New(15, -1)}, []byte{0xc0, 0x81}},
+		{true, &decimalDefaultType{1, decimal.New(150, -2)}, []byte{0xc0, 0x81}},
+		{false, &floatDefaultType{1, 1.5}, []byte{0xe0, 0x81, 0xff, 0x8f}},
+		{false, &decimalDefaultType{1, decimal.New(150, -2)}, []byte{0xc0, 0x81}},
+	}
+	for i, m := range messages {
+		buf := &bytes.Buffer{}
+		enc := fast.NewEncoder(buf, tpls...)
+		enc.SetNormalize(m.normalize)
+		if err = enc.Encode(m.msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), m.expect) {
+			t.Fatalf("message %d: data is not equal. current: %x expected: %x", i, buf.Bytes(), m.expect)
+		}
+	}
+}
+
+func TestPMapOverflowEncode(t *testing.T) {
+	// template id takes first bit of presence map
+	for count, expect := range map[int]error{62: nil, 63: fast.ErrPMapOverflow} {
+		fields := &strings.Builder{}
+		msg := map[string]interface{}{"*": 1}
+		for i := 1; i <= count; i++ {
+			fmt.Fprintf(fields, `<uInt32 name="Field%d" id="%d"><copy/></uInt32>`, i, i)
+			msg[fmt.Sprintf("Field%d", i)] = uint32(i)
+		}
+		tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="PMap" id="1">` + fields.String() + `</template>
+</templates>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = fast.NewEncoder(&bytes.Buffer{}, tpls...).Encode(msg); err != expect {
+			t.Fatalf("%d fields: expected error %v, got %v", count, expect, err)
+		}
+	}
+}
@@ -5,9 +5,13 @@
 package fast_test
 
 import (
+	"errors"
 	fast "github.com/co11ter/goFAST"
+	"strings"
 )
 
+var errInvalidCurrency = errors.New("invalid currency code")
+
 type decimalType struct {
 	TemplateID           uint `fast:"*"`
 	CopyDecimal          float64
@@ -68,6 +72,52 @@ type groupType struct {
 	}
 }
 
+type currencyCode string
+
+func (c *currencyCode) UnmarshalFASTField(v interface{}) error {
+	code, ok := v.(string)
+	if !ok || len(code) != 3 {
+		return errInvalidCurrency
+	}
+	*c = currencyCode(strings.ToUpper(code))
+	return nil
+}
+
+type currencyType struct {
+	TemplateID       uint `fast:"*"`
+	MandatoryAscii   currencyCode
+	OptionalAscii    string
+	MandatoryUnicode string
+	OptionalUnicode  string
+}
+
+type incrementType struct {
+	TemplateID uint `fast:"*"`
+	SeqNum     uint32
+}
+
+type nestedGroupType struct {
+	TemplateID uint `fast:"*"`
+	Value      uint32
+	Outer      struct {
+		Value uint32
+		Inner struct {
+			Value uint32
+		}
+	}
+}
+
+type stringDeltaType struct {
+	TemplateID    uint `fast:"*"`
+	OptionalDelta *string
+}
+
+type deltaDecimalType struct {
+	TemplateID             uint `fast:"*"`
+	DeltaDecimal           float64
+	IndividualDeltaDecimal float64
+}
+
 type benchmarkMessage struct {
 	TemplateID     uint   `fast:"*"`
 	MessageType    string `fast:"35"`
@@ -284,6 +334,25 @@ var (
 		OptionalInt64:   2222222222,
 	}
 
+	nestedGroupData1    = []byte{0xc0, 0x88, 0x81, 0x82, 0x83}
+	nestedGroupMessage1 = nestedGroupType{
+		TemplateID: 8,
+		Value:      1,
+		Outer: struct {
+			Value uint32
+			Inner struct {
+				Value uint32
+			}
+		}{
+			Value: 2,
+			Inner: struct {
+				Value uint32
+			}{
+				Value: 3,
+			},
+		},
+	}
+
 	groupData1    = []byte{0xe0, 0x86, 0x81, 0x82, 0x83}
 	groupMessage1 = groupType{
 		TemplateID: 6,
@@ -0,0 +1,112 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+/*
+Package fasttest implements helpers for testing of FAST messages.
+*/
+package fasttest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/co11ter/goFAST"
+)
+
+// AssertRoundTrip encodes msg by encoder with empty dictionary, decodes the result
+// to a new value of the same type and reports differences of decoded and original
+// messages. Msg must be a pointer to struct.
+func AssertRoundTrip(t testing.TB, tpls []*fast.Template, msg interface{}) {
+	t.Helper()
+
+	rv := reflect.ValueOf(msg)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		t.Fatalf("message is not pointer or nil: %T", msg)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := fast.NewEncoder(buf, tpls...).Encode(msg); err != nil {
+		t.Fatalf("can not encode %T: %v", msg, err)
+	}
+	data := fmt.Sprintf("%x", buf.Bytes())
+
+	got := reflect.New(rv.Type().Elem())
+	if err := fast.NewDecoder(buf, tpls...).Decode(got.Interface()); err != nil {
+		t.Fatalf("can not decode %T from %s: %v", msg, data, err)
+	}
+
+	if buf.Len() > 0 {
+		t.Fatalf("%d bytes are not decoded from %s", buf.Len(), data)
+	}
+
+	if !reflect.DeepEqual(got.Interface(), msg) {
+		var lines []string
+		diff(got.Elem(), rv.Elem(), rv.Elem().Type().Name(), &lines)
+		t.Fatalf("round trip of %T is not equal, data: %s\n%s", msg, data, strings.Join(lines, "\n"))
+	}
+}
+
+// diff collects paths and values of differing fields.
+func diff(got, expect reflect.Value, path string, lines *[]string) {
+	if got.Kind() != expect.Kind() || got.Type() != expect.Type() {
+		*lines = append(*lines, fmt.Sprintf("%s: got %v, expect %v", path, got, expect))
+		return
+	}
+
+	switch got.Kind() {
+	case reflect.Ptr:
+		if got.IsNil() || expect.IsNil() {
+			if got.IsNil() != expect.IsNil() {
+				*lines = append(*lines, fmt.Sprintf("%s: got %v, expect %v", path, value(got), value(expect)))
+			}
+			return
+		}
+		diff(got.Elem(), expect.Elem(), path, lines)
+	case reflect.Struct:
+		if !hasExportedField(got.Type()) {
+			// compare opaque struct like decimal.Decimal as a whole
+			if got.CanInterface() && !reflect.DeepEqual(got.Interface(), expect.Interface()) {
+				*lines = append(*lines, fmt.Sprintf("%s: got %v, expect %v", path, got, expect))
+			}
+			return
+		}
+		for i := 0; i < got.NumField(); i++ {
+			if got.Type().Field(i).PkgPath != "" {
+				continue // unexported
+			}
+			diff(got.Field(i), expect.Field(i), path+"."+got.Type().Field(i).Name, lines)
+		}
+	case reflect.Slice, reflect.Array:
+		if got.Len() != expect.Len() {
+			*lines = append(*lines, fmt.Sprintf("%s: got len %d, expect len %d", path, got.Len(), expect.Len()))
+			return
+		}
+		for i := 0; i < got.Len(); i++ {
+			diff(got.Index(i), expect.Index(i), fmt.Sprintf("%s[%d]", path, i), lines)
+		}
+	default:
+		if got.CanInterface() && !reflect.DeepEqual(got.Interface(), expect.Interface()) {
+			*lines = append(*lines, fmt.Sprintf("%s: got %v, expect %v", path, got, expect))
+		}
+	}
+}
+
+func hasExportedField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func value(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		return v.Elem().Interface()
+	}
+	return v.Interface()
+}
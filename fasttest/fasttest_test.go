@@ -0,0 +1,133 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fasttest_test
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/co11ter/goFAST"
+	"github.com/co11ter/goFAST/fasttest"
+	"github.com/shopspring/decimal"
+)
+
+type decimalType struct {
+	TemplateID           uint `fast:"*"`
+	CopyDecimal          float64
+	MandatoryDecimal     float64
+	IndividualDecimal    float64
+	IndividualDecimalOpt float64
+}
+
+// lossyType has field which is not present in template.
+type lossyType struct {
+	TemplateID           uint `fast:"*"`
+	CopyDecimal          float64
+	MandatoryDecimal     float64
+	IndividualDecimal    float64
+	IndividualDecimalOpt float64
+	Note                 string
+}
+
+// lossyDecimalType has decimal field which is not present in template.
+type lossyDecimalType struct {
+	TemplateID           uint `fast:"*"`
+	CopyDecimal          float64
+	MandatoryDecimal     float64
+	IndividualDecimal    float64
+	IndividualDecimalOpt float64
+	Rate                 decimal.Decimal
+}
+
+// fakeTB records the failure of test and stops the calling goroutine like testing.T.
+type fakeTB struct {
+	testing.TB
+	failure string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.failure = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func templates(t *testing.T) []*fast.Template {
+	ftpl, err := os.Open("../testdata/test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftpl.Close()
+
+	tpls, err := fast.ParseXMLTemplate(ftpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tpls
+}
+
+func TestAssertRoundTrip(t *testing.T) {
+	tpls := templates(t)
+
+	fasttest.AssertRoundTrip(t, tpls, &decimalType{
+		TemplateID:           1,
+		CopyDecimal:          5.15,
+		MandatoryDecimal:     154.6,
+		IndividualDecimal:    0.0032,
+		IndividualDecimalOpt: 11.1,
+	})
+}
+
+func TestAssertRoundTripFailure(t *testing.T) {
+	tpls := templates(t)
+
+	messages := []struct {
+		msg    interface{}
+		expect string
+	}{
+		{
+			&lossyType{
+				TemplateID:           1,
+				CopyDecimal:          5.15,
+				MandatoryDecimal:     154.6,
+				IndividualDecimal:    0.0032,
+				IndividualDecimalOpt: 11.1,
+				Note:                 "lost",
+			},
+			"lossyType.Note: got , expect lost",
+		},
+		{
+			&lossyDecimalType{
+				TemplateID:           1,
+				CopyDecimal:          5.15,
+				MandatoryDecimal:     154.6,
+				IndividualDecimal:    0.0032,
+				IndividualDecimalOpt: 11.1,
+				Rate:                 decimal.New(15, -1),
+			},
+			"lossyDecimalType.Rate: got 0, expect 1.5",
+		},
+	}
+
+	for _, m := range messages {
+		tb := &fakeTB{}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fasttest.AssertRoundTrip(tb, tpls, m.msg)
+		}()
+		<-done
+
+		if tb.failure == "" {
+			t.Fatal("round trip failure is not reported")
+		}
+		if !strings.Contains(tb.failure, m.expect) {
+			t.Fatalf("wrong failure: %q, expect path: %q", tb.failure, m.expect)
+		}
+	}
+}
@@ -15,6 +15,17 @@ type Field struct {
 	Value interface{}
 
 	index *int // message field index for reflection
+	typ InstructionType // type of instruction for reflection
+}
+
+// RawField contains decoded value and raw bytes consumed from the stream to
+// decode it. Instruction is nil for presence map, template id and trailing
+// bytes of message, which have Name "pmap", "*" and "rest" accordingly.
+type RawField struct {
+	Instruction *Instruction
+	Name        string
+	Value       interface{}
+	Data        []byte
 }
 
 var fieldPool = sync.Pool{
@@ -32,5 +43,6 @@ func releaseField(field *Field) {
 	field.Name = ""
 	field.Value = nil
 	field.index = nil
+	field.typ = TypeNull
 	fieldPool.Put(field)
 }
\ No newline at end of file
@@ -4,6 +4,16 @@
 
 package fast
 
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+)
+
 // Instruction contains rules for encoding/decoding field.
 type Instruction struct {
 	ID           uint
@@ -13,13 +23,20 @@ type Instruction struct {
 	Operator     InstructionOperator
 	Instructions []*Instruction
 	Value        interface{}
+	Rounding     RoundingMode
+	BigEndian    bool // fixed-width big-endian integer instead of stop bit encoding
 
 	pMapSize int
 	key   string
+	templateRef string // name of referenced template, it's resolved after parsing
 }
 
 func (i *Instruction) isValid() bool {
-	if i.Operator == OperatorDelta && (i.Type < TypeUint32 || i.Type > TypeMantissa) {
+	if i.Operator == OperatorDelta && !i.isInteger() && !i.isString() && i.Type != TypeDecimal {
+		return false
+	}
+
+	if i.Operator == OperatorIncrement && !i.isInteger() {
 		return false
 	}
 
@@ -27,9 +44,22 @@ func (i *Instruction) isValid() bool {
 		return false
 	}
 
+	// fixed-width integer has no null value and delta is always stop bit encoded
+	if i.BigEndian && (!i.isInteger() || i.isNullable() || i.Operator == OperatorDelta) {
+		return false
+	}
+
 	return true
 }
 
+func (i *Instruction) isInteger() bool {
+	return i.Type >= TypeUint32 && i.Type <= TypeMantissa
+}
+
+func (i *Instruction) isString() bool {
+	return i.Type >= TypeASCIIString && i.Type <= TypeByteVector
+}
+
 func (i *Instruction) isOptional() bool {
 	return i.Presence == PresenceOptional
 }
@@ -61,7 +91,7 @@ func (i *Instruction) inject(writer *writer, s storage, pmap *pMap, value interf
 		}
 		s.save(i.key, value)
 	case OperatorDefault:
-		if i.Value == value {
+		if equal(i.Value, value) {
 			pmap.SetNextBit(false)
 			s.save(i.key, value)
 			return
@@ -75,10 +105,20 @@ func (i *Instruction) inject(writer *writer, s storage, pmap *pMap, value interf
 			s.save(i.key, value)
 		}
 	case OperatorDelta:
-		if previous := s.load(i.key); previous != nil {
-			value = delta(value, previous)
+		if i.isString() {
+			return i.injectStringDelta(writer, s, value)
 		}
-		err = i.write(writer, value)
+		if i.Type == TypeDecimal {
+			return i.injectDecimalDelta(writer, s, value)
+		}
+		if value == nil {
+			return writer.WriteNil()
+		}
+		var delta int64
+		if delta, err = i.intDelta(value, i.deltaBase(s)); err != nil {
+			return
+		}
+		err = writer.WriteInt(i.isNullable(), delta, maxSize64)
 		if err != nil {
 			return
 		}
@@ -88,8 +128,16 @@ func (i *Instruction) inject(writer *writer, s storage, pmap *pMap, value interf
 	case OperatorCopy, OperatorIncrement:
 		previous := s.load(i.key)
 		s.save(i.key, value)
+		if i.Operator == OperatorIncrement && previous != nil && value != nil && value == increment(previous) {
+			pmap.SetNextBit(false)
+			return
+		}
+		if i.Operator == OperatorCopy && previous != nil && value != nil && equal(previous, value) {
+			pmap.SetNextBit(false)
+			return
+		}
 		if previous == nil {
-			if i.Value == value {
+			if equal(i.Value, value) {
 				pmap.SetNextBit(false)
 				return
 			}
@@ -112,6 +160,10 @@ func (i *Instruction) write(writer *writer, value interface{}) (err error) {
 		return
 	}
 
+	if i.BigEndian {
+		return writer.WriteFixed(uint64(toInt64(value)), i.fixedSize())
+	}
+
 	switch i.Type {
 	case TypeByteVector:
 		err = writer.WriteByteVector(i.isNullable(), value.([]byte))
@@ -122,13 +174,13 @@ func (i *Instruction) write(writer *writer, value interface{}) (err error) {
 	case TypeASCIIString:
 		err = writer.WriteString(i.isNullable(), value.(string))
 	case TypeUnicodeString:
-		err = writer.WriteByteVector(i.isNullable(), []byte(value.(string)))
+		err = writer.WriteByteVector(i.isNullable(), toBytes(value))
 	case TypeInt64, TypeMantissa:
 		err = writer.WriteInt(i.isNullable(), value.(int64), maxSize64)
 	case TypeInt32, TypeExponent:
 		err = writer.WriteInt(i.isNullable(), int64(value.(int32)), maxSize32)
 	case TypeDecimal:
-		mantissa, exponent := newMantExp(value.(float64))
+		mantissa, exponent := mantExpOf(value)
 		err = writer.WriteInt(i.isNullable(), int64(exponent), maxSize32)
 		if err != nil {
 			return
@@ -168,12 +220,19 @@ func (i *Instruction) extract(reader *reader, s storage, pmap *pMap) (result int
 			s.save(i.key, result)
 		}
 	case OperatorDelta:
-		result, err = i.read(reader)
-		if err != nil {
+		if i.isString() {
+			return i.extractStringDelta(reader, s)
+		}
+		if i.Type == TypeDecimal {
+			return i.extractDecimalDelta(reader, s)
+		}
+		tmp, err := reader.ReadInt(i.isNullable())
+		if err != nil || tmp == nil {
 			return nil, err
 		}
-		if previous := s.load(i.key); previous != nil {
-			result = sum(result, previous)
+		result, err = i.applyIntDelta(i.deltaBase(s), *tmp)
+		if err != nil {
+			return nil, err
 		}
 		s.save(i.key, result)
 	case OperatorTail:
@@ -205,6 +264,18 @@ func (i *Instruction) extract(reader *reader, s storage, pmap *pMap) (result int
 }
 
 func (i *Instruction) read(reader *reader) (result interface{}, err error) {
+	if i.BigEndian {
+		tmp, err := reader.ReadFixed(i.fixedSize())
+		if err != nil {
+			return result, err
+		}
+		if i.fixedSize() == 4 {
+			// keep sign of 32-bit integer
+			return i.fromInt64(int64(int32(tmp))), nil
+		}
+		return i.fromInt64(int64(tmp)), nil
+	}
+
 	switch i.Type {
 	case TypeByteVector:
 		tmp, err := reader.ReadByteVector(i.isNullable())
@@ -243,7 +314,9 @@ func (i *Instruction) read(reader *reader) (result interface{}, err error) {
 		if err != nil {
 			return result, err
 		}
-		if tmp != nil {
+		if tmp != nil && reader.unicodeBytes {
+			result = append([]byte(nil), *tmp...)
+		} else if tmp != nil {
 			result = string(*tmp)
 		}
 	case TypeInt64, TypeMantissa:
@@ -273,15 +346,249 @@ func (i *Instruction) read(reader *reader) (result interface{}, err error) {
 			if err != nil {
 				return result, err
 			}
-			result = newFloat(*mantissa, exponent)
+			result = newDecimal(*mantissa, exponent, reader.exactDecimal)
 		}
 	}
 
 	return result, err
 }
 
+// deltaBase returns the previous value, the initial value if the previous
+// value is not defined or nil if there is no initial value.
+func (i *Instruction) deltaBase(s storage) interface{} {
+	if previous := s.load(i.key); previous != nil {
+		return previous
+	}
+	return i.Value
+}
+
+// intDelta returns difference of integer value and base. Difference which does
+// not fit in int64 returns ErrR4.
+func (i *Instruction) intDelta(value, base interface{}) (int64, error) {
+	if i.Type == TypeUint64 {
+		v, b := toUint64(value), toUint64(base)
+		if v >= b {
+			if v-b > math.MaxInt64 {
+				return 0, ErrR4
+			}
+			return int64(v - b), nil
+		}
+		if b-v > 1<<63 {
+			return 0, ErrR4
+		}
+		return -int64(b - v), nil
+	}
+
+	v, b := toInt64(value), toInt64(base)
+	delta := v - b
+	if (v >= 0) != (b >= 0) && (delta >= 0) != (v >= 0) {
+		return 0, ErrR4
+	}
+	return delta, nil
+}
+
+// applyIntDelta adds delta to integer base. Result which does not fit in type
+// of instruction returns ErrR4.
+func (i *Instruction) applyIntDelta(base interface{}, delta int64) (interface{}, error) {
+	if i.Type == TypeUint64 {
+		b := toUint64(base)
+		if delta >= 0 {
+			if b+uint64(delta) < b {
+				return nil, ErrR4
+			}
+			return b + uint64(delta), nil
+		}
+		if uint64(-delta) > b {
+			return nil, ErrR4
+		}
+		return b - uint64(-delta), nil
+	}
+
+	b := toInt64(base)
+	result := b + delta
+	if (delta > 0 && result < b) || (delta < 0 && result > b) {
+		return nil, ErrR4
+	}
+	return i.fromInt64(result), nil
+}
+
+// injectDecimalDelta writes difference of exponents and difference of mantissas
+// of value and the previous value.
+func (i *Instruction) injectDecimalDelta(writer *writer, s storage, value interface{}) (err error) {
+	if value == nil {
+		return writer.WriteNil()
+	}
+
+	mantissa, exponent := mantExpOf(value)
+	baseMantissa, baseExponent := i.decimalDeltaBase(s)
+
+	err = writer.WriteInt(i.isNullable(), int64(exponent-baseExponent), maxSize32)
+	if err != nil {
+		return
+	}
+	err = writer.WriteInt(false, mantissa-baseMantissa, maxSize64)
+	if err != nil {
+		return
+	}
+
+	s.save(i.key, decimalValue{mantissa: mantissa, exponent: exponent})
+	return
+}
+
+func (i *Instruction) extractDecimalDelta(reader *reader, s storage) (interface{}, error) {
+	exponent, err := reader.ReadInt(i.isNullable())
+	if err != nil || exponent == nil {
+		return nil, err
+	}
+	value := decimalValue{exponent: int32(*exponent)}
+
+	mantissa, err := reader.ReadInt(false)
+	if err != nil {
+		return nil, err
+	}
+	value.mantissa = *mantissa
+
+	baseMantissa, baseExponent := i.decimalDeltaBase(s)
+	value.mantissa += baseMantissa
+	value.exponent += baseExponent
+
+	s.save(i.key, value)
+	return newDecimal(value.mantissa, value.exponent, reader.exactDecimal), nil
+}
+
+// decimalDeltaBase returns mantissa and exponent of the previous value, the initial
+// value if the previous value is not defined or zeros if there is no initial value.
+func (i *Instruction) decimalDeltaBase(s storage) (int64, int32) {
+	if previous, ok := s.load(i.key).(decimalValue); ok {
+		return previous.mantissa, previous.exponent
+	}
+	if i.Value != nil {
+		return mantExpOf(i.Value)
+	}
+	return 0, 0
+}
+
+// injectStringDelta writes subtraction length and difference between
+// the previous value and value. Null value is written as null subtraction
+// length and does not change the previous value.
+func (i *Instruction) injectStringDelta(writer *writer, s storage, value interface{}) (err error) {
+	if value == nil {
+		return writer.WriteNil()
+	}
+
+	base := i.stringDeltaBase(s)
+	current := toBytes(value)
+
+	prefix := 0
+	for prefix < len(base) && prefix < len(current) && base[prefix] == current[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(base) && suffix < len(current) &&
+		base[len(base)-suffix-1] == current[len(current)-suffix-1] {
+		suffix++
+	}
+
+	// negative subtraction length removes from the front, -1 means zero
+	var length int64
+	var diff []byte
+	if prefix >= suffix {
+		length = int64(len(base) - prefix)
+		diff = current[prefix:]
+	} else {
+		length = -int64(len(base)-suffix) - 1
+		diff = current[:len(current)-suffix]
+	}
+
+	err = writer.WriteInt(i.isNullable(), length, maxSize32)
+	if err != nil {
+		return
+	}
+
+	if i.Type == TypeASCIIString {
+		err = writer.WriteString(false, string(diff))
+	} else {
+		err = writer.WriteByteVector(false, diff)
+	}
+	if err != nil {
+		return
+	}
+
+	s.save(i.key, value)
+	return
+}
+
+func (i *Instruction) extractStringDelta(reader *reader, s storage) (interface{}, error) {
+	length, err := reader.ReadInt(i.isNullable())
+	if err != nil || length == nil {
+		return nil, err
+	}
+	sub := *length
+
+	var diff []byte
+	if i.Type == TypeASCIIString {
+		tmp, err := reader.ReadString(false)
+		if err != nil {
+			return nil, err
+		}
+		diff = []byte(*tmp)
+	} else {
+		tmp, err := reader.ReadByteVector(false)
+		if err != nil {
+			return nil, err
+		}
+		diff = *tmp
+	}
+
+	base := i.stringDeltaBase(s)
+	var result []byte
+	if sub >= 0 {
+		if sub > int64(len(base)) {
+			return nil, ErrD7
+		}
+		result = append(append(result, base[:int64(len(base))-sub]...), diff...)
+	} else {
+		sub = -sub - 1
+		if sub > int64(len(base)) {
+			return nil, ErrD7
+		}
+		result = append(append(result, diff...), base[sub:]...)
+	}
+
+	var value interface{} = result
+	if i.Type != TypeByteVector {
+		value = string(result)
+	}
+	if i.Type == TypeUnicodeString && !utf8.Valid(result) {
+		return nil, ErrR2
+	}
+
+	s.save(i.key, value)
+	return value, nil
+}
+
+// stringDeltaBase returns the previous value, the initial value if the previous
+// value is not defined or empty base if there is no initial value.
+func (i *Instruction) stringDeltaBase(s storage) []byte {
+	if previous := s.load(i.key); previous != nil {
+		return toBytes(previous)
+	}
+	if i.Value != nil {
+		return toBytes(i.Value)
+	}
+	return nil
+}
+
 func (i *Instruction) injectDecimal(writer *writer, s storage, pmap *pMap, value interface{}) (err error) {
-	mantissa, exponent := newMantExp(value.(float64))
+	var mantissa int64
+	var exponent int32
+	if scale, ok := i.scale(); ok {
+		mantissa, exponent = newScaledMantExp(value, scale, i.Rounding)
+	} else {
+		mantissa, exponent = mantExpOf(value)
+	}
+
 	for _, in := range i.Instructions {
 		if in.Type == TypeMantissa {
 			err = in.inject(writer, s, pmap, mantissa)
@@ -320,7 +627,17 @@ func (i *Instruction) extractDecimal(reader *reader, s storage, pmap *pMap) (int
 		}
 	}
 
-	return newFloat(mantissa, exponent), nil
+	return newDecimal(mantissa, exponent, reader.exactDecimal), nil
+}
+
+// scale returns exponent of decimal if it is fixed by constant operator.
+func (i *Instruction) scale() (int32, bool) {
+	for _, in := range i.Instructions {
+		if in.Type == TypeExponent && in.Operator == OperatorConstant {
+			return in.Value.(int32), true
+		}
+	}
+	return 0, false
 }
 
 func isEmpty(value interface{}) bool {
@@ -358,21 +675,6 @@ func sum(values ...interface{}) (res interface{}) {
 	return
 }
 
-// TODO need implements for string
-func delta(values ...interface{}) (res interface{}) {
-	switch values[0].(type) {
-	case int64:
-		res = values[0].(int64) - int64(toInt(values[1]))
-	case int32:
-		res = values[0].(int32) - int32(toInt(values[1]))
-	case uint64:
-		res = values[0].(uint64) - uint64(toInt(values[1]))
-	case uint32:
-		res = values[0].(uint32) - uint32(toInt(values[1]))
-	}
-	return
-}
-
 func toInt(value interface{}) int {
 	switch value.(type) {
 	case int64:
@@ -387,10 +689,168 @@ func toInt(value interface{}) int {
 		return value.(int)
 	case uint:
 		return int(value.(uint))
+	case json.Number:
+		tmp, _ := value.(json.Number).Int64()
+		return int(tmp)
 	}
 	return 0
 }
 
+// equal compares values of the same instruction. Decimals are compared by
+// mantissa and exponent, so decimal.Decimal is equal to float64 with the
+// same mantissa and exponent.
+func equal(a, b interface{}) bool {
+	if tmp, ok := a.([]byte); ok {
+		switch other := b.(type) {
+		case []byte:
+			return bytes.Equal(tmp, other)
+		case string:
+			// unicode string may be []byte or string
+			return string(tmp) == other
+		}
+		return false
+	}
+	if tmp, ok := b.([]byte); ok {
+		other, ok := a.(string)
+		return ok && string(tmp) == other
+	}
+
+	_, aDecimal := a.(decimal.Decimal)
+	_, bDecimal := b.(decimal.Decimal)
+	if aDecimal || bDecimal {
+		if !isDecimalValue(a) || !isDecimalValue(b) {
+			return false
+		}
+		aMant, aExp := mantExpOf(a)
+		bMant, bExp := mantExpOf(b)
+		return aMant == bMant && aExp == bExp
+	}
+	return a == b
+}
+
+func isDecimalValue(value interface{}) bool {
+	switch value.(type) {
+	case decimal.Decimal, float64:
+		return true
+	}
+	return false
+}
+
+func toInt64(value interface{}) int64 {
+	switch value.(type) {
+	case int64:
+		return value.(int64)
+	case int32:
+		return int64(value.(int32))
+	case uint64:
+		return int64(value.(uint64))
+	case uint32:
+		return int64(value.(uint32))
+	case int:
+		return int64(value.(int))
+	case uint:
+		return int64(value.(uint))
+	}
+	return 0
+}
+
+func toUint64(value interface{}) uint64 {
+	if v, ok := value.(uint64); ok {
+		return v
+	}
+	return uint64(toInt64(value))
+}
+
+// fixedSize returns size of fixed-width integer in bytes.
+func (i *Instruction) fixedSize() int {
+	switch i.Type {
+	case TypeUint64, TypeInt64, TypeMantissa:
+		return 8
+	}
+	return 4
+}
+
+// fromInt64 converts value to type of integer instruction.
+func (i *Instruction) fromInt64(value int64) interface{} {
+	switch i.Type {
+	case TypeUint32, TypeLength:
+		return uint32(value)
+	case TypeInt32, TypeExponent:
+		return int32(value)
+	case TypeUint64:
+		return uint64(value)
+	}
+	return value
+}
+
+// fromJSONNumber converts json.Number to type of instruction. Integer that
+// does not fit the type returns ErrR4, number with fraction part for integer
+// instruction returns ErrR5 and decimal with mantissa overflow returns ErrR1.
+func (i *Instruction) fromJSONNumber(number json.Number) (interface{}, error) {
+	switch i.Type {
+	case TypeASCIIString, TypeUnicodeString:
+		return number.String(), nil
+	case TypeDecimal:
+		d, err := decimal.NewFromString(number.String())
+		if err != nil {
+			return nil, ErrD1
+		}
+		if !d.Coefficient().IsInt64() {
+			return nil, ErrR1
+		}
+		return d, nil
+	}
+
+	if !i.isInteger() {
+		return nil, ErrD1
+	}
+
+	d, err := decimal.NewFromString(number.String())
+	if err != nil {
+		return nil, ErrD1
+	}
+	if !d.Equal(d.Truncate(0)) {
+		return nil, ErrR5
+	}
+
+	var size int
+	switch i.Type {
+	case TypeUint32, TypeInt32, TypeLength, TypeExponent:
+		size = 32
+	default:
+		size = 64
+	}
+
+	str := d.String()
+	switch i.Type {
+	case TypeUint32, TypeUint64, TypeLength:
+		value, err := strconv.ParseUint(str, 10, size)
+		if err != nil {
+			return nil, ErrR4
+		}
+		if size == 32 {
+			return uint32(value), nil
+		}
+		return value, nil
+	}
+
+	value, err := strconv.ParseInt(str, 10, size)
+	if err != nil {
+		return nil, ErrR4
+	}
+	return i.fromInt64(value), nil
+}
+
+func toBytes(value interface{}) []byte {
+	switch value.(type) {
+	case string:
+		return []byte(value.(string))
+	case []byte:
+		return value.([]byte)
+	}
+	return nil
+}
+
 func increment(value interface{}) (res interface{}) {
 	return sum(value, 1)
 }
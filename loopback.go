@@ -0,0 +1,16 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fast
+
+import "io"
+
+// NewLoopback returns encoder writing to rw and decoder reading from rw with
+// mirrored dictionaries. It may be used to simulate a stateful peer in tests.
+// Encoder and decoder have separate dictionaries, which are updated by the
+// same operators, so they are equal after every message decoded in order of
+// encoding. Both of them have to be reset together to keep dictionaries mirrored.
+func NewLoopback(rw io.ReadWriter, tmps ...*Template) (*Encoder, *Decoder) {
+	return NewEncoder(rw, tmps...), NewDecoder(rw, tmps...)
+}
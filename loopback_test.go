@@ -0,0 +1,128 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fast_test
+
+import (
+	"bytes"
+	"github.com/co11ter/goFAST"
+	"strings"
+	"testing"
+)
+
+func TestLoopback(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Quote" id="1">
+		<string name="Symbol" id="55"><copy/></string>
+		<uInt32 name="Price" id="44"><copy/></uInt32>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type quoteType struct {
+		TemplateID uint `fast:"*"`
+		Symbol     string
+		Price      uint32
+	}
+
+	buf := &bytes.Buffer{}
+	enc, dec := fast.NewLoopback(buf, tpls...)
+
+	messages := []struct {
+		msg    quoteType
+		expect []byte
+	}{
+		{quoteType{1, "ABC", 10}, []byte{0xf0, 0x81, 0x41, 0x42, 0xc3, 0x8a}},
+		{quoteType{1, "ABC", 11}, []byte{0xd0, 0x81, 0x8b}},
+		{quoteType{1, "ABC", 11}, []byte{0xc0, 0x81}},
+	}
+	for i, m := range messages {
+		if err = enc.Encode(&m.msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		if !bytes.Equal(buf.Bytes(), m.expect) {
+			t.Fatalf("message %d: data is not equal. current: %x expected: %x", i, buf.Bytes(), m.expect)
+		}
+
+		var got quoteType
+		if err = dec.Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if got != m.msg {
+			t.Fatal("messages is not equal, got: ", got, ", expect: ", m.msg)
+		}
+	}
+
+	enc.Reset()
+	dec.Reset()
+	if err = enc.Encode(&messages[2].msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+	var got quoteType
+	if err = dec.Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if got != messages[2].msg {
+		t.Fatal("messages is not equal after reset, got: ", got, ", expect: ", messages[2].msg)
+	}
+}
+
+func TestLoopbackDeltaIncrement(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Trade" id="1">
+		<uInt32 name="SeqNum" id="34"><increment/></uInt32>
+		<int64 name="Price" id="44"><delta/></int64>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type tradeType struct {
+		TemplateID uint `fast:"*"`
+		SeqNum     uint32
+		Price      int64
+	}
+
+	buf := &bytes.Buffer{}
+	enc, dec := fast.NewLoopback(buf, tpls...)
+
+	messages := []tradeType{{1, 1, 10}, {1, 2, 20}, {1, 3, 30}}
+
+	// decode every message right after encoding
+	for _, msg := range messages {
+		if err = enc.Encode(&msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+		var got tradeType
+		if err = dec.Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if got != msg {
+			t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+		}
+	}
+
+	// decode messages after all of them are encoded
+	enc.Reset()
+	dec.Reset()
+	for _, msg := range messages {
+		if err = enc.Encode(&msg); err != nil {
+			t.Fatal("can not encode", err)
+		}
+	}
+	for _, msg := range messages {
+		var got tradeType
+		if err = dec.Decode(&got); err != nil {
+			t.Fatal("can not decode", err)
+		}
+		if got != msg {
+			t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+		}
+	}
+}
@@ -35,3 +35,18 @@ type Receiver interface {
 	Lock(*Field) bool
 	Unlock()
 }
+
+// FieldProvider is interface for getting data by name avoid reflection.
+// FASTField must return template id for name "*", value of field for name
+// of field, FieldProvider for name of group and slice of FieldProvider for
+// name of sequence. Second result is false if the value is absent.
+type FieldProvider interface {
+	FASTField(name string) (interface{}, bool)
+}
+
+// FASTFieldUnmarshaler is implemented by types of message fields that can
+// convert a decoded value to themselves. Decoder passes the decoded value
+// of the instruction (string, uint32, float64, etc) to UnmarshalFASTField.
+type FASTFieldUnmarshaler interface {
+	UnmarshalFASTField(v interface{}) error
+}
@@ -4,11 +4,14 @@
 
 package fast
 
-const defaultMask = 128
+// defaultMask is the initial mask of encoded presence map. Bits are set from
+// the most significant one, so the presence map can contain up to 63 bits. Mask
+// becomes zero, if more bits are set.
+const defaultMask = 1 << 63
 
 type pMap struct {
-	bitmap uint
-	mask uint
+	bitmap uint64
+	mask uint64
 }
 
 func (p *pMap) IsNextBitSet() bool {
@@ -0,0 +1,127 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fast
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMissingField is returned if a value of mandatory field is not found by FieldProvider.
+var ErrMissingField = errors.New("encoder: mandatory field is missing")
+
+// mapProvider adapts map[string]interface{} to FieldProvider. Groups are
+// map[string]interface{} values and sequences are []map[string]interface{}
+// or []interface{} values.
+type mapProvider map[string]interface{}
+
+func (m mapProvider) FASTField(name string) (interface{}, bool) {
+	value, ok := m[name]
+	return value, ok
+}
+
+// provider adapts FieldProvider to Sender.
+type provider struct {
+	current   FieldProvider
+	providers []FieldProvider
+}
+
+func newProvider(p FieldProvider) *provider {
+	return &provider{current: p, providers: []FieldProvider{p}}
+}
+
+func (p *provider) GetTemplateID() uint {
+	if value, ok := p.current.FASTField("*"); ok {
+		return uint(toInt(value))
+	}
+	return 0
+}
+
+func (p *provider) GetValue(field *Field) {
+	if value, ok := p.current.FASTField(field.Name); ok {
+		field.Value = value
+	}
+}
+
+func (p *provider) GetLength(field *Field) {
+	field.Value = 0
+	if value, ok := p.current.FASTField(field.Name); ok {
+		switch seq := value.(type) {
+		case []FieldProvider:
+			field.Value = len(seq)
+		case []map[string]interface{}:
+			field.Value = len(seq)
+		case []interface{}:
+			field.Value = len(seq)
+		}
+	}
+}
+
+// Lock locks nested provider of group or sequence element. It returns false,
+// if the nested provider is not found.
+func (p *provider) Lock(field *Field) bool {
+	next, ok := p.lookUp(field)
+	if !ok {
+		return false
+	}
+	p.providers = append(p.providers, next)
+	p.current = next
+	return true
+}
+
+func (p *provider) Unlock() {
+	p.providers = p.providers[:len(p.providers)-1]
+	p.current = p.providers[len(p.providers)-1]
+}
+
+func (p *provider) lookUp(field *Field) (FieldProvider, bool) {
+	value, ok := p.current.FASTField(field.Name)
+	if !ok {
+		return nil, false
+	}
+
+	index, isElem := field.Value.(int)
+	switch seq := value.(type) {
+	case []FieldProvider:
+		if isElem && index < len(seq) {
+			return seq[index], true
+		}
+	case []map[string]interface{}:
+		if isElem && index < len(seq) {
+			return mapProvider(seq[index]), true
+		}
+	case []interface{}:
+		if isElem && index < len(seq) {
+			return providerOf(seq[index])
+		}
+	default:
+		return providerOf(value)
+	}
+	return nil, false
+}
+
+// has reports whether the current provider contains field.
+func (p *provider) has(name string) bool {
+	_, ok := p.current.FASTField(name)
+	return ok
+}
+
+// missing returns ErrMissingField with name of field if the field is mandatory.
+func (p *provider) missing(instruction *Instruction) error {
+	if instruction.isOptional() || instruction.Operator == OperatorConstant {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrMissingField, instruction.Name)
+}
+
+func providerOf(value interface{}) (FieldProvider, bool) {
+	switch group := value.(type) {
+	case FieldProvider:
+		return group, true
+	case map[string]interface{}:
+		return mapProvider(group), true
+	}
+	return nil, false
+}
@@ -17,7 +17,11 @@ const (
 type reader struct {
 	reader io.Reader
 	strBuf bytes.Buffer
-	bytes  []byte
+	entity []byte // the last read stop bit entity
+
+	pmapBytes int // length of the last read presence map in bytes
+	exactDecimal bool // read decimals as decimal.Decimal instead of float64
+	unicodeBytes bool // read unicode string as []byte instead of string
 
 	tmpErr  error
 	tmpUint uint64
@@ -29,64 +33,48 @@ type reader struct {
 }
 
 func newReader(r io.Reader) *reader {
-	return &reader{reader: r, strBuf: bytes.Buffer{}, bytes: make([]byte, 1)}
+	return &reader{reader: r, strBuf: bytes.Buffer{}}
 }
 
 func (r *reader) ReadPMap() (m *pMap, err error) {
+	r.entity, err = readStopBitEntity(r.reader, r.entity[:0])
+	if err != nil {
+		return nil, err
+	}
+	r.pmapBytes = len(r.entity)
+
 	m = new(pMap)
 	m.mask = 1
-	for i := 0; i < maxLoadBytes; i++ {
-		_, err = r.reader.Read(r.bytes)
-		if err != nil {
-			return
+	for i, b := range r.entity {
+		// TODO what have to do with bits beyond 64?
+		if i >= maxLoadBytes {
+			break
 		}
-
 		m.bitmap <<= 7
-		m.bitmap |= uint(r.bytes[0]) & 0x7F
+		m.bitmap |= uint64(b) & 0x7F
 		m.mask <<= 7
-
-		if 0x80 == (r.bytes[0] & 0x80) {
-			return
-		}
-	}
-
-	for {
-		_, err = r.reader.Read(r.bytes)
-		if err != nil {
-			return
-		}
-
-		if (r.bytes[0] & 0x80) == 0 {
-			return
-		}
 	}
-
-	// TODO what have to do here?
 	return
 }
 
 func (r *reader) ReadInt(nullable bool) (*int64, error) {
-	_, r.tmpErr = r.reader.Read(r.bytes)
+	r.entity, r.tmpErr = readStopBitEntity(r.reader, r.entity[:0])
 	if r.tmpErr != nil {
 		return nil, r.tmpErr
 	}
 
 	r.tmpDcrm = 1
 
-	if (r.bytes[0] & 0x40) > 0 {
-		r.tmpInt = int64((-1 ^ int8(0x7F)) | int8((r.bytes[0] & 0x7F)))
+	if (r.entity[0] & 0x40) > 0 {
+		r.tmpInt = int64((-1 ^ int8(0x7F)) | int8((r.entity[0] & 0x7F)))
 		r.tmpDcrm = 0
 	} else {
-		r.tmpInt = int64(r.bytes[0] & 0x3F)
+		r.tmpInt = int64(r.entity[0] & 0x3F)
 	}
 
-	for (r.bytes[0] & 0x80) == 0 {
+	for _, b := range r.entity[1:] {
 		r.tmpInt <<= 7
-		_, r.tmpErr = r.reader.Read(r.bytes)
-		if r.tmpErr != nil {
-			return nil, r.tmpErr
-		}
-		r.tmpInt |= int64(r.bytes[0] & 0x7F)
+		r.tmpInt |= int64(b & 0x7F)
 	}
 
 	if nullable {
@@ -100,20 +88,15 @@ func (r *reader) ReadInt(nullable bool) (*int64, error) {
 }
 
 func (r *reader) ReadUint(nullable bool) (*uint64, error) {
-	_, r.tmpErr = r.reader.Read(r.bytes)
+	r.entity, r.tmpErr = readStopBitEntity(r.reader, r.entity[:0])
 	if r.tmpErr != nil {
 		return nil, r.tmpErr
 	}
 
-	r.tmpUint = uint64(r.bytes[0] & 0x7F)
-
-	for (r.bytes[0] & 0x80) == 0 {
+	r.tmpUint = 0
+	for _, b := range r.entity {
 		r.tmpUint <<= 7
-		_, r.tmpErr = r.reader.Read(r.bytes)
-		if r.tmpErr != nil {
-			return nil, r.tmpErr
-		}
-		r.tmpUint |= uint64(r.bytes[0] & 0x7F)
+		r.tmpUint |= uint64(b & 0x7F)
 	}
 
 	if nullable {
@@ -126,6 +109,25 @@ func (r *reader) ReadUint(nullable bool) (*uint64, error) {
 	return &r.tmpUint, nil
 }
 
+// ReadFixed reads size bytes of big-endian integer.
+func (r *reader) ReadFixed(size int) (uint64, error) {
+	if cap(r.tmpByte) < size {
+		r.tmpByte = make([]byte, size)
+	}
+	r.tmpByte = r.tmpByte[:size]
+
+	_, r.tmpErr = io.ReadFull(r.reader, r.tmpByte)
+	if r.tmpErr != nil {
+		return 0, r.tmpErr
+	}
+
+	r.tmpUint = 0
+	for _, b := range r.tmpByte {
+		r.tmpUint = r.tmpUint<<8 | uint64(b)
+	}
+	return r.tmpUint, nil
+}
+
 func (r *reader) ReadByteVector(nullable bool) (*[]byte, error) {
 	r.tmpLen, r.tmpErr = r.ReadUint(nullable)
 	if r.tmpErr != nil || r.tmpLen == nil {
@@ -144,53 +146,52 @@ func (r *reader) ReadByteVector(nullable bool) (*[]byte, error) {
 
 // read ascii string
 func (r *reader) ReadString(nullable bool) (*string, error) {
-	_, r.tmpErr = r.reader.Read(r.bytes)
+	r.entity, r.tmpErr = readStopBitEntity(r.reader, r.entity[:0])
 	if r.tmpErr != nil {
 		return nil, r.tmpErr
 	}
 
-	if (r.bytes[0] & 0x7F) == 0 {
-		if r.bytes[0] == 0x80 {
+	if (r.entity[0] & 0x7F) == 0 {
+		switch {
+		case len(r.entity) == 1:
 			if nullable {
 				return nil, nil
 			}
-			return &r.tmpStr, nil
-		}
-
-		_, r.tmpErr = r.reader.Read(r.bytes)
-		if r.tmpErr != nil {
+		case len(r.entity) == 2:
+		case nullable && len(r.entity) == 3 && r.entity[1] == 0x00:
+		default:
+			r.tmpErr = ErrR9
 			return nil, r.tmpErr
 		}
-
-		if r.bytes[0] == 0x80 {
-			return &r.tmpStr, nil
-		} else if nullable && r.bytes[0] == 0x00 {
-			_, r.tmpErr = r.reader.Read(r.bytes)
-			if r.tmpErr != nil {
-				return nil, r.tmpErr
-			}
-
-			if r.bytes[0] == 0x80 {
-				return &r.tmpStr, nil
-			}
-		}
-		r.tmpErr = ErrR9
-		return nil, r.tmpErr
+		r.tmpStr = ""
+		return &r.tmpStr, nil
 	}
 
-	for {
-		if (r.bytes[0] & 0x80) > 0 {
-			r.strBuf.WriteByte(r.bytes[0] & 0x7F)
-			break
-		}
-		r.strBuf.WriteByte(r.bytes[0])
-		_, r.tmpErr = r.reader.Read(r.bytes)
-		if r.tmpErr != nil {
-			return nil, r.tmpErr
-		}
+	for _, b := range r.entity {
+		r.strBuf.WriteByte(b & 0x7F)
 	}
 
 	r.tmpStr = r.strBuf.String()
 	r.strBuf.Reset()
 	return &r.tmpStr, nil
 }
+
+// readerTap collects bytes read from io.Reader and splits them to raw fields.
+type readerTap struct {
+	io.Reader
+	buf    []byte
+	fields []RawField
+}
+
+func (t *readerTap) Read(b []byte) (n int, err error) {
+	n, err = t.Reader.Read(b)
+	t.buf = append(t.buf, b[:n]...)
+	return
+}
+
+func (t *readerTap) capture(instruction *Instruction, name string, value interface{}) {
+	data := make([]byte, len(t.buf))
+	copy(data, t.buf)
+	t.buf = t.buf[:0]
+	t.fields = append(t.fields, RawField{Instruction: instruction, Name: name, Value: value, Data: data})
+}
@@ -6,24 +6,67 @@ package fast
 
 import (
 	"errors"
+	"math"
 	"reflect"
 	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
 )
 
 const structTag = "fast"
 
-var regCache = make(map[string]*register)
+// tagOptionRest is the option of struct tag for []byte field of message, which
+// receives trailing bytes of message not consumed by template: `fast:",rest"`.
+// The field is filled by capture decoder and DecodeEmbedded only.
+const tagOptionRest = "rest"
+
+// tagOptionExponent is the option of struct tag for decimal field split into two
+// integer instructions: `fast:"Price,exponent=PriceScale"`. The field name
+// (or tag name) specifies int64 instruction of mantissa and the option
+// specifies int32 instruction of exponent by name or id: `fast:"270,exponent=271"`.
+const tagOptionExponent = "exponent="
+
+var regCache = make(map[reflect.Type]*register)
+
+var decimalType = reflect.TypeOf(decimal.Decimal{})
+
+var unmarshalerType = reflect.TypeOf((*FASTFieldUnmarshaler)(nil)).Elem()
 
 type register struct {
 	prefer bool // true for map by id
 	byName map[string]int
 	byID   map[int]int
+	nested map[int]*register // registers of struct fields by field index
+	split  map[int]string    // exponent instruction names of split decimals by field index
+	rest   *int              // index of field for trailing bytes of message
+
+	unmarshalers map[int]bool // fields implementing FASTFieldUnmarshaler by field index
+}
+
+func newRegister(rt reflect.Type) *register {
+	r := &register{
+		byName: make(map[string]int),
+		byID: make(map[int]int),
+		nested: make(map[int]*register),
+		split: make(map[int]string),
+		unmarshalers: make(map[int]bool),
+	}
+	countID, countName := parseType(rt, r)
+	if countID >= countName {
+		r.prefer = true
+	}
+	return r
 }
 
 type reflector struct {
 	current *register
+	registers []*register
 	values []reflect.Value
 	index int
+
+	err error // error of FASTFieldUnmarshaler
+	parts map[uintptr]decimalValue // decoded parts of split decimals by field address
 }
 
 func makeMsg(msg interface{}) (m *reflector) {
@@ -36,24 +79,54 @@ func makeMsg(msg interface{}) (m *reflector) {
 	rt := reflect.TypeOf(msg).Elem()
 
 	var ok bool
-	name := rt.PkgPath() + "." + rt.Name()
-	if m.current, ok = regCache[name]; !ok {
-		m.current = &register{byName: make(map[string]int), byID: make(map[int]int)}
-		countID, countName := parseType(rt, m.current)
-		if countID >= countName {
-			m.current.prefer = true
-		}
-		regCache[name] = m.current
+	if m.current, ok = regCache[rt]; !ok {
+		m.current = newRegister(rt)
+		regCache[rt] = m.current
 	}
+	m.registers = []*register{m.current}
 	return
 }
 
+// reset sets message to zero value. Slices of sequences keep capacity, so
+// SetLength reuses it.
+func (m *reflector) reset() {
+	resetValue(m.values[0].Elem())
+}
+
+func resetValue(v reflect.Value) {
+	if v.Kind() != reflect.Struct || !hasOnlyExportedFields(v.Type()) {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Slice || extractType(field.Type().Elem()).Kind() != reflect.Struct {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+
+		elems := field.Slice(0, field.Cap())
+		for j := 0; j < elems.Len(); j++ {
+			resetValue(elems.Index(j))
+		}
+		field.SetLen(0)
+	}
+}
+
 func (m *reflector) Lock(field *Field) bool {
 	v, ok := m.lookUpRField(field)
 	if !ok {
 		return false
 	}
 
+	nested, ok := m.current.nested[*field.index]
+	if !ok {
+		return false
+	}
+
+	v = extractValue(v)
+
 	if v.Kind() == reflect.Slice {
 		v = extractValue(v.Index(field.Value.(int)))
 		m.values = append(m.values, v.Addr())
@@ -61,13 +134,17 @@ func (m *reflector) Lock(field *Field) bool {
 		v = extractValue(v)
 		m.values = append(m.values, v.Addr())
 	}
+	m.registers = append(m.registers, nested)
+	m.current = nested
 	m.index++
 	return true
 }
 
 func (m *reflector) Unlock() {
 	m.values = m.values[:m.index]
+	m.registers = m.registers[:m.index]
 	m.index--
+	m.current = m.registers[m.index]
 }
 
 // find value in message and assign to field
@@ -80,18 +157,77 @@ func (m *reflector) GetValue(field *Field) {
 		} else {
 			field.Value = rField.Interface()
 		}
+
+		if exponent, ok := m.current.split[*field.index]; ok && field.Value != nil {
+			mantissa, exp := mantExpOf(field.Value)
+			if isExponent(field, exponent) {
+				field.Value, m.err = splitPart(field.typ, int64(exp))
+			} else {
+				field.Value, m.err = splitPart(field.typ, mantissa)
+			}
+		}
+	}
+}
+
+// isExponent reports whether field is exponent of split decimal. Exponent is
+// specified by name or id of instruction.
+func isExponent(field *Field, exponent string) bool {
+	if id, err := strconv.Atoi(exponent); err == nil {
+		return int(field.ID) == id
+	}
+	return field.Name == exponent
+}
+
+// splitPart converts mantissa or exponent of split decimal to type of integer
+// instruction. Value that does not fit the type returns ErrR4.
+func splitPart(typ InstructionType, value int64) (interface{}, error) {
+	switch typ {
+	case TypeUint32, TypeLength:
+		if value < 0 || value > math.MaxUint32 {
+			return nil, ErrR4
+		}
+		return uint32(value), nil
+	case TypeInt32, TypeExponent:
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			return nil, ErrR4
+		}
+		return int32(value), nil
+	case TypeUint64:
+		if value < 0 {
+			return nil, ErrR4
+		}
+		return uint64(value), nil
+	}
+	return value, nil
+}
+
+// isBytes reports whether field of message is []byte.
+func (m *reflector) isBytes(field *Field) bool {
+	rField, ok := m.lookUpRField(field)
+	if !ok || m.current.unmarshalers[*field.index] {
+		return false
 	}
+	rt := extractType(rField.Type())
+	return rt.Kind() == reflect.Slice && rt.Elem().Kind() == reflect.Uint8
 }
 
 // find slice len in message and assign to field
 func (m *reflector) GetLength(field *Field) {
 	if rField, ok := m.lookUpRField(field); ok {
+		if rField.Kind() == reflect.Ptr {
+			if rField.IsNil() {
+				field.Value = 0
+				return
+			}
+			rField = rField.Elem()
+		}
 		field.Value = rField.Len()
 	}
 }
 
 func (m *reflector) SetLength(field *Field) {
 	if rField, ok := m.lookUpRField(field); ok {
+		rField = extractValue(rField)
 		length := field.Value.(int)
 		if length > rField.Cap() {
 			newValue := reflect.MakeSlice(rField.Type(), length, length)
@@ -99,9 +235,7 @@ func (m *reflector) SetLength(field *Field) {
 			rField.Set(newValue)
 		}
 
-		if length > rField.Len() {
-			rField.SetLen(length)
-		}
+		rField.SetLen(length)
 	}
 }
 
@@ -128,15 +262,62 @@ func (m *reflector) SetTemplateID(tid uint) {
 // set field value to message
 func (m *reflector) SetValue(field *Field) {
 	if rField, ok := m.lookUpRField(field); ok {
+		if m.current.unmarshalers[*field.index] {
+			u := extractValue(rField).Addr().Interface().(FASTFieldUnmarshaler)
+			m.err = u.UnmarshalFASTField(field.Value)
+			return
+		}
+		if exponent, ok := m.current.split[*field.index]; ok {
+			m.setDecimalPart(rField, isExponent(field, exponent), field.Value)
+			return
+		}
 		m.set(rField, reflect.ValueOf(field.Value))
 	}
 }
 
+// setRest sets trailing bytes of message to rest field.
+func (m *reflector) setRest(data []byte) {
+	if m.registers[0].rest == nil || len(data) == 0 {
+		return
+	}
+	field := extractValue(m.values[0]).Field(*m.registers[0].rest)
+	m.set(field, reflect.ValueOf(data))
+}
+
+// setDecimalPart sets mantissa or exponent of split decimal. The field is
+// assigned after each part, so the value is complete after both parts.
+func (m *reflector) setDecimalPart(field reflect.Value, exponent bool, value interface{}) {
+	if m.parts == nil {
+		m.parts = make(map[uintptr]decimalValue)
+	}
+	key := field.Addr().Pointer()
+	part := m.parts[key]
+	if exponent {
+		part.exponent = int32(toInt64(value))
+	} else {
+		part.mantissa = toInt64(value)
+	}
+	m.parts[key] = part
+	m.set(field, reflect.ValueOf(decimal.New(part.mantissa, part.exponent)))
+}
+
 func (m *reflector) set(field reflect.Value, value reflect.Value) {
 	if field.Kind() == reflect.Ptr {
 		field.Set(reflect.New(field.Type().Elem()))
 		field = field.Elem()
 	}
+	switch {
+	case value.Type() == decimalType:
+		d := value.Interface().(decimal.Decimal)
+		switch field.Kind() {
+		case reflect.String:
+			value = reflect.ValueOf(formatDecimal(d))
+		case reflect.Float64:
+			value = reflect.ValueOf(toFloat(d))
+		}
+	case value.Kind() == reflect.Float64 && field.Type() == decimalType:
+		value = reflect.ValueOf(decimal.NewFromFloat(value.Float()))
+	}
 	if field.Kind() == reflect.Slice {
 		newValue := reflect.MakeSlice(field.Type(), value.Len(), value.Len())
 		reflect.Copy(newValue, value)
@@ -155,7 +336,7 @@ func (m *reflector) lookUpRField(field *Field) (v reflect.Value, ok bool) {
 	}
 
 	v = extractValue(m.values[m.index])
-	v = extractValue(v.Field(*field.index))
+	v = v.Field(*field.index)
 	ok = true
 	return
 }
@@ -187,6 +368,7 @@ func parseType(rt reflect.Type, current *register) (countID, countName int) {
 		field reflect.StructField
 		tmp reflect.Type
 		name string
+		options []string
 		id int
 		err error
 		ok bool
@@ -195,11 +377,35 @@ func parseType(rt reflect.Type, current *register) (countID, countName int) {
 
 		field = rt.Field(i)
 
-		name = lookUpTag(field)
+		name, options = lookUpTag(field)
 		if name == "" {
 			continue
 		}
 
+		if len(options) > 0 && options[0] == tagOptionRest {
+			index := i
+			current.rest = &index
+			continue
+		}
+
+		for _, option := range options {
+			if strings.HasPrefix(option, tagOptionExponent) {
+				exponent := strings.TrimPrefix(option, tagOptionExponent)
+				if id, err = strconv.Atoi(exponent); err == nil {
+					if _, ok = current.byID[id]; ok {
+						panic(errors.New("found duplicate struct field"))
+					}
+					current.byID[id] = i
+				} else {
+					if _, ok = current.byName[exponent]; ok {
+						panic(errors.New("found duplicate struct field"))
+					}
+					current.byName[exponent] = i
+				}
+				current.split[i] = exponent
+			}
+		}
+
 		id, err = strconv.Atoi(name)
 		if err == nil {
 			countID++
@@ -216,21 +422,42 @@ func parseType(rt reflect.Type, current *register) (countID, countName int) {
 		}
 
 		tmp = extractType(field.Type)
+		if reflect.PtrTo(tmp).Implements(unmarshalerType) {
+			current.unmarshalers[i] = true
+		}
 
 		// extract first element of slice
 		if tmp.Kind() == reflect.Slice {
 			tmp = extractType(tmp.Elem())
 		}
 
-		if tmp.Kind() == reflect.Struct {
-			d, n := parseType(tmp, current)
-			countID += d
-			countID += n
+		// value types like decimal.Decimal have no exported fields and can not be
+		// group or sequence element
+		if tmp.Kind() == reflect.Struct && hasExportedField(tmp) {
+			current.nested[i] = newRegister(tmp)
 		}
 	}
 	return
 }
 
+func hasOnlyExportedFields(rt reflect.Type) bool {
+	for i := 0; i < rt.NumField(); i++ {
+		if rt.Field(i).PkgPath != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func hasExportedField(rt reflect.Type) bool {
+	for i := 0; i < rt.NumField(); i++ {
+		if rt.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
 func extractValue(rv reflect.Value) reflect.Value {
 	if rv.Kind() == reflect.Ptr {
 		if rv.IsNil() {
@@ -248,12 +475,20 @@ func extractType(rt reflect.Type) reflect.Type {
 	return rt
 }
 
-func lookUpTag(field reflect.StructField) string {
-	if tag, ok := field.Tag.Lookup(structTag); ok && tag != "" {
-		if tag == "-" {
-			return ""
-		}
-		return tag
+// lookUpTag returns name of instruction and options of struct field. Name is
+// the first element of comma-separated tag, field name is used if it is empty.
+func lookUpTag(field reflect.StructField) (string, []string) {
+	tag, ok := field.Tag.Lookup(structTag)
+	if !ok || tag == "" {
+		return field.Name, nil
+	}
+	if tag == "-" {
+		return "", nil
+	}
+
+	options := strings.Split(tag, ",")
+	if options[0] == "" {
+		options[0] = field.Name
 	}
-	return field.Name
+	return options[0], options[1:]
 }
@@ -4,6 +4,9 @@
 
 package fast
 
+// templateIDKey is a dictionary key of the last template id.
+const templateIDKey = "*"
+
 type storage map[string]interface{}
 
 func newStorage() storage {
@@ -21,3 +24,9 @@ func (s storage) load(key string) interface{} {
 	return nil
 }
 
+// clear removes all values of dictionary.
+func (s storage) clear() {
+	for key := range s {
+		delete(s, key)
+	}
+}
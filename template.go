@@ -6,12 +6,17 @@ package fast
 
 import (
 	"encoding/xml"
+	"fmt"
 	"io"
+	"io/fs"
 	"strconv"
+
+	"github.com/shopspring/decimal"
 )
 
 const (
-	tagTemplate = "template"
+	tagTemplate    = "template"
+	tagTemplateRef = "templateRef"
 
 	tagString     = "string"
 	tagInt32      = "int32"
@@ -38,10 +43,17 @@ const (
 	attrPresence = "presence"
 	attrValue    = "value"
 	attrCharset  = "charset"
+	attrRounding = "rounding"
+	attrEncoding = "encoding"
+	attrVersion  = "version"
 
 	valueMandatory = "mandatory"
 	valueOptional  = "optional"
 	valueUnicode   = "unicode"
+	valueHalfUp    = "halfUp"
+	valueHalfEven  = "halfEven"
+	valueDown      = "down"
+	valueBigEndian = "bigEndian"
 )
 
 // InstructionType specifies the basic encoding of the field.
@@ -87,9 +99,110 @@ const (
 type Template struct {
 	ID           uint
 	Name         string
+	Version      string
 	Instructions []*Instruction
 }
 
+// PmapBitCount returns count of bits in presence map of message, including the
+// bit of template id. Bits of presence maps of groups and sequences are not counted.
+func (t *Template) PmapBitCount() int {
+	return 1 + pmapBitCount(t.Instructions)
+}
+
+func pmapBitCount(instructions []*Instruction) (count int) {
+	for _, i := range instructions {
+		switch {
+		case i.Type == TypeDecimal && len(i.Instructions) > 0:
+			count += pmapBitCount(i.Instructions)
+		case i.Type == TypeSequence:
+			count += pmapBitCount(i.Instructions[:1])
+		case i.Type == TypeGroup:
+			if i.isOptional() {
+				count++
+			}
+			// group without own presence map uses presence map of parent
+			if i.pMapSize == 0 {
+				count += pmapBitCount(i.Instructions)
+			}
+		case i.hasPmapBit():
+			count++
+		}
+	}
+	return
+}
+
+// CompatibleWith reports whether messages of t and other are wire-compatible
+// and returns differences of templates. Templates are compatible if the
+// instructions of common prefix have the same type, presence, operator and
+// initial value and the instructions appended to the tail of the longer
+// template are optional. Groups and sequences have to contain the same
+// instructions. Different names of instructions are reported, but they do not
+// break compatibility.
+func (t *Template) CompatibleWith(other *Template) (bool, []string) {
+	return compareInstructions("", t.Instructions, other.Instructions)
+}
+
+func compareInstructions(path string, a, b []*Instruction) (compatible bool, diffs []string) {
+	compatible = true
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i >= len(a) || i >= len(b) {
+			extra := b
+			if len(a) > len(b) {
+				extra = a
+			}
+			in := extra[i]
+			switch {
+			case path != "":
+				// appended field of group or sequence shifts the rest of message
+				compatible = false
+				diffs = append(diffs, fmt.Sprintf("%s%s: appended nested field", path, in.Name))
+			case in.isOptional():
+				diffs = append(diffs, fmt.Sprintf("%s%s: appended optional field", path, in.Name))
+			default:
+				compatible = false
+				diffs = append(diffs, fmt.Sprintf("%s%s: appended mandatory field", path, in.Name))
+			}
+			continue
+		}
+
+		x, y := a[i], b[i]
+		if x.Name != y.Name {
+			diffs = append(diffs, fmt.Sprintf("%s%s: name differs: %s", path, x.Name, y.Name))
+		}
+
+		var differs []string
+		if x.Type != y.Type {
+			differs = append(differs, "type")
+		}
+		if x.Presence != y.Presence {
+			differs = append(differs, "presence")
+		}
+		if x.Operator != y.Operator {
+			differs = append(differs, "operator")
+		}
+		if !equal(x.Value, y.Value) {
+			differs = append(differs, "value")
+		}
+		if x.BigEndian != y.BigEndian {
+			differs = append(differs, "encoding")
+		}
+		if x.pMapSize != y.pMapSize {
+			differs = append(differs, "presence map size")
+		}
+		for _, d := range differs {
+			compatible = false
+			diffs = append(diffs, fmt.Sprintf("%s%s: %s differs", path, x.Name, d))
+		}
+
+		if len(differs) == 0 && len(x.Instructions)+len(y.Instructions) > 0 {
+			ok, nested := compareInstructions(path+x.Name+".", x.Instructions, y.Instructions)
+			compatible = compatible && ok
+			diffs = append(diffs, nested...)
+		}
+	}
+	return
+}
+
 func (t *Template) clone() (res Template) {
 	res = *t
 	res.Instructions = cloneInstructions(t.Instructions)
@@ -120,16 +233,52 @@ func ParseXMLTemplate(reader io.Reader) ([]*Template, error) {
 	return newXMLParser(reader).Parse()
 }
 
+// ParseXMLTemplateFS reads xml data from named files of fsys and return merged
+// templates collection. Static template references are resolved across all files.
+func ParseXMLTemplateFS(fsys fs.FS, names ...string) ([]*Template, error) {
+	var templates []*Template
+	for _, name := range names {
+		file, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		tmp, err := newXMLParser(file).parse()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmp...)
+	}
+
+	err := finalizeTemplates(templates)
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
 func newXMLParser(reader io.Reader) *xmlParser {
 	return &xmlParser{decoder: xml.NewDecoder(reader)}
 }
 
 func (p *xmlParser) Parse() (templates []*Template, err error) {
+	templates, err = p.parse()
+	if err != nil {
+		return
+	}
+
+	err = finalizeTemplates(templates)
+	return
+}
+
+func (p *xmlParser) parse() (templates []*Template, err error) {
 	var token xml.Token
 	var template *Template
 	for {
 		token, err = p.decoder.Token()
 		if err == io.EOF {
+			err = nil
 			break
 		}
 		if err != nil {
@@ -145,8 +294,24 @@ func (p *xmlParser) Parse() (templates []*Template, err error) {
 		}
 	}
 
+	return
+}
+
+func finalizeTemplates(templates []*Template) (err error) {
+	byName := make(map[string]*Template, len(templates))
+	for _, tpl := range templates {
+		byName[tpl.Name] = tpl
+	}
+
+	for _, tpl := range templates {
+		tpl.Instructions, err = resolveTemplateRefs(tpl.Instructions, byName, map[string]bool{tpl.Name: true})
+		if err != nil {
+			return
+		}
+	}
+
 	for _, tpl := range templates {
-		err = p.postProcessing(tpl.Instructions)
+		err = postProcessing(tpl.Instructions)
 		if err != nil {
 			break
 		}
@@ -155,17 +320,72 @@ func (p *xmlParser) Parse() (templates []*Template, err error) {
 	return
 }
 
-func (p *xmlParser) postProcessing(instructions []*Instruction) (err error) {
+// resolveTemplateRefs replaces static template references by copy of instructions
+// of the referenced template. Visited contains names of templates in the current
+// chain of references to detect recursion.
+func resolveTemplateRefs(instructions []*Instruction, byName map[string]*Template, visited map[string]bool) ([]*Instruction, error) {
+	var res []*Instruction
+	for _, item := range instructions {
+		if item.templateRef == "" {
+			var err error
+			item.Instructions, err = resolveTemplateRefs(item.Instructions, byName, visited)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, item)
+			continue
+		}
+
+		tpl, ok := byName[item.templateRef]
+		if !ok {
+			return nil, ErrD8
+		}
+		if visited[tpl.Name] {
+			return nil, ErrS1
+		}
+
+		visited[tpl.Name] = true
+		inner, err := resolveTemplateRefs(copyInstructions(tpl.Instructions), byName, visited)
+		delete(visited, tpl.Name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, inner...)
+	}
+	return res, nil
+}
+
+// copyInstructions returns deep copy of instructions.
+func copyInstructions(data []*Instruction) []*Instruction {
+	if data == nil {
+		return nil
+	}
+
+	res := make([]*Instruction, len(data))
+	for i, item := range data {
+		tmp := *item
+		tmp.Instructions = copyInstructions(item.Instructions)
+		res[i] = &tmp
+	}
+	return res
+}
+
+func postProcessing(instructions []*Instruction) (err error) {
 	for _, item := range instructions {
 		if !item.isValid() {
 			return ErrS2
 		}
 
+		// presence of exponent and length is known after parsing of decimal and sequence
+		if item.Presence == PresenceMandatory && item.Operator == OperatorDefault && item.Value == nil {
+			return ErrS5
+		}
+
 		item.key = strconv.Itoa(int(item.ID)) + ":" +
 			item.Name + ":" +
 			strconv.Itoa(int(item.Type))
 
-		err = p.postProcessing(item.Instructions)
+		err = postProcessing(item.Instructions)
 		if err != nil {
 			return err
 		}
@@ -278,9 +498,32 @@ func (p *xmlParser) parseInstruction(token *xml.StartElement) (*Instruction, err
 		}
 	}
 
+	if instruction.Type == TypeDecimal && !validDecimalComponents(instruction) {
+		return nil, ErrS1
+	}
+
 	return instruction, nil
 }
 
+// validDecimalComponents checks that decimal with individual operators has
+// exactly one exponent and one mantissa.
+func validDecimalComponents(instruction *Instruction) bool {
+	if len(instruction.Instructions) == 0 {
+		return true
+	}
+
+	var exponents, mantissas int
+	for _, inner := range instruction.Instructions {
+		switch inner.Type {
+		case TypeExponent:
+			exponents++
+		case TypeMantissa:
+			mantissas++
+		}
+	}
+	return exponents == 1 && mantissas == 1 && len(instruction.Instructions) == 2
+}
+
 func (p *xmlParser) parseOperation(token *xml.StartElement, instruction *Instruction) error {
 	switch token.Name.Local {
 	case tagConstant:
@@ -307,12 +550,6 @@ func (p *xmlParser) parseOperation(token *xml.StartElement, instruction *Instruc
 		return ErrS4
 	}
 
-	if instruction.Presence == PresenceMandatory &&
-		instruction.Operator == OperatorDefault &&
-		instruction.Value == nil {
-		return ErrS5
-	}
-
 	for {
 		token, err := p.decoder.Token()
 		if err != nil {
@@ -355,6 +592,17 @@ func newInstruction(token *xml.StartElement) (*Instruction, error) {
 		instruction.Type = TypeMantissa
 	case tagByteVector:
 		instruction.Type = TypeByteVector
+	case tagTemplateRef:
+		instruction.Type = TypeNull
+		for _, attr := range token.Attr {
+			if attr.Name.Local == attrName {
+				instruction.templateRef = attr.Value
+			}
+		}
+		// dynamic template reference is not supported
+		if instruction.templateRef == "" {
+			return nil, ErrS1
+		}
 	default:
 		instruction.Type = TypeNull
 	}
@@ -380,6 +628,22 @@ func newInstruction(token *xml.StartElement) (*Instruction, error) {
 			if attr.Value == valueUnicode {
 				instruction.Type = TypeUnicodeString
 			}
+		case attrRounding:
+			switch attr.Value {
+			case valueHalfUp:
+				instruction.Rounding = RoundHalfUp
+			case valueHalfEven:
+				instruction.Rounding = RoundHalfEven
+			case valueDown:
+				instruction.Rounding = RoundDown
+			default:
+				return nil, ErrS1
+			}
+		case attrEncoding:
+			if attr.Value != valueBigEndian {
+				return nil, ErrS1
+			}
+			instruction.BigEndian = true
 		}
 	}
 
@@ -399,6 +663,8 @@ func newTemplate(token *xml.StartElement) (*Template, error) {
 				return nil, err
 			}
 			template.ID = uint(id)
+		case attrVersion:
+			template.Version = attr.Value
 		}
 	}
 
@@ -421,6 +687,9 @@ func newValue(token *xml.StartElement, typ InstructionType) (value interface{},
 			case TypeInt32, TypeExponent:
 				value, err = strconv.ParseInt(attr.Value, 10, 32)
 				value = int32(value.(int64))
+			case TypeDecimal:
+				// decimal keeps exponent of initial value: 1.50 -> 150e-2
+				value, err = decimal.NewFromString(attr.Value)
 			}
 			return
 		}
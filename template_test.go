@@ -1,9 +1,12 @@
 package fast_test
 
 import (
+	"bytes"
 	"github.com/co11ter/goFAST"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 var (
@@ -12,7 +15,7 @@ var (
 <templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
 	<template name="Test" id="1" xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
 		<string name="Type" id="15">
-			<delta/>
+			<increment/>
 		</string>
 	</template>
 </templates>`
@@ -37,6 +40,66 @@ var (
 	</template>
 </templates>`
 
+	xmlErrS5Integer = `
+<?xml version="1.0" encoding="UTF-8"?>
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Test" id="1" xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+		<uInt32 name="Type" id="15">
+			<default/>
+		</uInt32>
+	</template>
+</templates>`
+
+	xmlErrS5Exponent = `
+<?xml version="1.0" encoding="UTF-8"?>
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Test" id="1" xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+		<decimal name="Price" id="44">
+			<exponent><default/></exponent>
+			<mantissa><delta/></mantissa>
+		</decimal>
+	</template>
+</templates>`
+
+	xmlOptionalDefault = `
+<?xml version="1.0" encoding="UTF-8"?>
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Test" id="1" xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+		<uInt32 name="Type" id="15" presence="optional">
+			<default/>
+		</uInt32>
+		<decimal name="Price" id="44" presence="optional">
+			<exponent><default/></exponent>
+			<mantissa><delta/></mantissa>
+		</decimal>
+		<sequence name="Entries" presence="optional">
+			<length name="NoEntries" id="268"><default/></length>
+			<uInt32 name="Value" id="1"/>
+		</sequence>
+	</template>
+</templates>`
+
+	xmlErrDecimalMantissa = `
+<?xml version="1.0" encoding="UTF-8"?>
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Test" id="1" xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+		<decimal name="Price" id="44">
+			<mantissa><delta/></mantissa>
+			<mantissa><copy/></mantissa>
+		</decimal>
+	</template>
+</templates>`
+
+	xmlErrDecimalExponent = `
+<?xml version="1.0" encoding="UTF-8"?>
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Test" id="1" xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+		<decimal name="Price" id="44">
+			<mantissa><delta/></mantissa>
+		</decimal>
+	</template>
+</templates>`
+
 	xmlErrS5 = `
 <?xml version="1.0" encoding="UTF-8"?>
 <templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
@@ -53,6 +116,11 @@ func TestParseXMLTemplate(t *testing.T) {
 	checkErr(t, xmlErrS3, fast.ErrS3)
 	checkErr(t, xmlErrS4, fast.ErrS4)
 	checkErr(t, xmlErrS5, fast.ErrS5)
+	checkErr(t, xmlErrS5Integer, fast.ErrS5)
+	checkErr(t, xmlErrS5Exponent, fast.ErrS5)
+	checkErr(t, xmlOptionalDefault, nil)
+	checkErr(t, xmlErrDecimalMantissa, fast.ErrS1)
+	checkErr(t, xmlErrDecimalExponent, fast.ErrS1)
 }
 
 func checkErr(t *testing.T, data string, err error) {
@@ -61,3 +129,144 @@ func checkErr(t *testing.T, data string, err error) {
 		t.Fatal("not found err: '", err, "' got '", got, "'")
 	}
 }
+
+func TestTemplate_PmapBitCount(t *testing.T) {
+	expect := map[uint]int{
+		1: 4, // template id, copy decimal and exponents of individual decimals
+		2: 1,
+		6: 2, // template id and optional group
+		7: 2,
+	}
+
+	for _, tpl := range decoderTemplates(t) {
+		count, ok := expect[tpl.ID]
+		if !ok {
+			continue
+		}
+		if got := tpl.PmapBitCount(); got != count {
+			t.Fatalf("wrong pmap bit count of template %d, got: %d, expect: %d", tpl.ID, got, count)
+		}
+	}
+}
+
+func TestParseXMLTemplateFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"header.xml": {Data: []byte(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Header" id="10">
+		<uInt32 name="MsgSeqNum" id="34"/>
+		<templateRef name="Session"/>
+	</template>
+</templates>`)},
+		"order.xml": {Data: []byte(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Order" id="11">
+		<templateRef name="Header"/>
+		<string name="Symbol" id="55"/>
+	</template>
+	<template name="Session" id="12">
+		<string name="SenderCompID" id="49"><constant value="MOEX"/></string>
+	</template>
+</templates>`)},
+	}
+
+	tpls, err := fast.ParseXMLTemplateFS(fsys, "order.xml", "header.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpls) != 3 {
+		t.Fatal("wrong count of templates: ", len(tpls))
+	}
+
+	var names []string
+	for _, in := range tpls[0].Instructions {
+		names = append(names, in.Name)
+	}
+	if expect := []string{"MsgSeqNum", "SenderCompID", "Symbol"}; !reflect.DeepEqual(names, expect) {
+		t.Fatal("wrong instructions of Order, got: ", names, ", expect: ", expect)
+	}
+
+	type order struct {
+		TemplateID   uint `fast:"*"`
+		MsgSeqNum    uint32
+		SenderCompID string
+		Symbol       string
+	}
+	msg := order{TemplateID: 11, MsgSeqNum: 7, SenderCompID: "MOEX", Symbol: "SBER"}
+
+	buf := &bytes.Buffer{}
+	if err = fast.NewEncoder(buf, tpls...).Encode(&msg); err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	var got order
+	if err = fast.NewDecoder(buf, tpls...).Decode(&got); err != nil {
+		t.Fatal("can not decode", err)
+	}
+	if got != msg {
+		t.Fatal("messages is not equal, got: ", got, ", expect: ", msg)
+	}
+
+	_, err = fast.ParseXMLTemplateFS(fsys, "order.xml")
+	if err != fast.ErrD8 {
+		t.Fatal("not found err: '", fast.ErrD8, "' got '", err, "'")
+	}
+}
+
+func TestTemplate_CompatibleWith(t *testing.T) {
+	tpls, err := fast.ParseXMLTemplate(strings.NewReader(`
+<templates xmlns="http://www.fixprotocol.org/ns/fast/td/1.1">
+	<template name="Quote" id="1" version="1">
+		<string name="Symbol" id="55"><copy/></string>
+		<group name="Px">
+			<uInt32 name="Price" id="44"/>
+		</group>
+	</template>
+	<template name="Quote" id="2" version="2">
+		<string name="Symbol" id="55"><copy/></string>
+		<group name="Px">
+			<uInt32 name="Price" id="44"/>
+			<uInt32 name="Size" id="38" presence="optional"/>
+		</group>
+		<string name="Venue" id="30" presence="optional"/>
+	</template>
+	<template name="Quote" id="3" version="3">
+		<string name="Symbol" id="55"/>
+		<group name="Px">
+			<uInt64 name="Price" id="44"/>
+		</group>
+		<string name="Venue" id="30"/>
+	</template>
+	<template name="Quote" id="4" version="4">
+		<string name="Symbol" id="55"><copy/></string>
+		<group name="Px">
+			<uInt32 name="Price" id="44"/>
+		</group>
+		<string name="Venue" id="30" presence="optional"/>
+	</template>
+</templates>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpls[0].Version != "1" || tpls[1].Version != "2" {
+		t.Fatal("wrong versions: ", tpls[0].Version, tpls[1].Version)
+	}
+
+	ok, diffs := tpls[0].CompatibleWith(tpls[3])
+	expect := []string{"Venue: appended optional field"}
+	if !ok || !reflect.DeepEqual(diffs, expect) {
+		t.Fatal("templates are not compatible: ", ok, diffs)
+	}
+
+	ok, diffs = tpls[0].CompatibleWith(tpls[1])
+	expect = []string{"Px.Size: appended nested field", "Venue: appended optional field"}
+	if ok || !reflect.DeepEqual(diffs, expect) {
+		t.Fatal("templates are compatible: ", ok, diffs)
+	}
+
+	ok, diffs = tpls[0].CompatibleWith(tpls[2])
+	expect = []string{"Symbol: operator differs", "Px.Price: type differs", "Venue: appended mandatory field"}
+	if ok || !reflect.DeepEqual(diffs, expect) {
+		t.Fatal("templates are compatible: ", ok, diffs)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fast
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTraceMismatch is returned by DecodeTrace.Verify if traces are different.
+var ErrTraceMismatch = errors.New("trace: decoding decisions do not match")
+
+var operatorNames = map[InstructionOperator]string{
+	OperatorNone:      "none",
+	OperatorConstant:  tagConstant,
+	OperatorDelta:     tagDelta,
+	OperatorDefault:   tagDefault,
+	OperatorCopy:      tagCopy,
+	OperatorIncrement: tagIncrement,
+	OperatorTail:      tagTail,
+}
+
+// TraceStep is a decision of decoder for one instruction: the operator and
+// bits of presence map read for the instruction.
+type TraceStep struct {
+	Name     string // name of instruction, "*" for template id, "Px.exponent" for part of decimal
+	Operator InstructionOperator
+	Bits     []bool
+}
+
+// String returns step as name:operator=bits, e.g. Price:copy=1.
+func (s TraceStep) String() string {
+	var b strings.Builder
+	b.WriteString(s.Name)
+	b.WriteByte(':')
+	b.WriteString(operatorNames[s.Operator])
+	b.WriteByte('=')
+	for _, bit := range s.Bits {
+		if bit {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+// DecodeTrace contains decisions of decoder for a message in order of decoding.
+type DecodeTrace struct {
+	Steps []TraceStep
+}
+
+// String returns steps separated by space.
+func (t *DecodeTrace) String() string {
+	steps := make([]string, len(t.Steps))
+	for i, step := range t.Steps {
+		steps[i] = step.String()
+	}
+	return strings.Join(steps, " ")
+}
+
+// Verify compares trace with expected one and returns ErrTraceMismatch
+// with the first different step.
+func (t *DecodeTrace) Verify(expected *DecodeTrace) error {
+	for i := 0; i < len(t.Steps) || i < len(expected.Steps); i++ {
+		var got, want string
+		if i < len(t.Steps) {
+			got = t.Steps[i].String()
+		}
+		if i < len(expected.Steps) {
+			want = expected.Steps[i].String()
+		}
+		if got != want {
+			return fmt.Errorf("%w: step %d is %q, expected %q", ErrTraceMismatch, i, got, want)
+		}
+	}
+	return nil
+}
+
+// add records bits of presence map after mask up to end inclusive.
+func (t *DecodeTrace) add(name string, operator InstructionOperator, pmap *pMap, mask, end uint64) {
+	step := TraceStep{Name: name, Operator: operator}
+	for m := mask >> 1; m != 0 && m >= end; m >>= 1 {
+		step.Bits = append(step.Bits, pmap.bitmap&m != 0)
+	}
+	t.Steps = append(t.Steps, step)
+}
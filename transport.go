@@ -0,0 +1,132 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fast
+
+import (
+	"io"
+)
+
+const stopBit = 0x80
+
+// BitReader is implemented by transports which deliver data bit by bit.
+// Use NewBitReader to decode FAST messages from such transport.
+type BitReader interface {
+	// ReadBit returns the next bit of the stream.
+	ReadBit() (bool, error)
+}
+
+// BitWriter is implemented by transports which send data bit by bit.
+// Use NewBitWriter to encode FAST messages to such transport.
+type BitWriter interface {
+	// WriteBit sends the next bit of the stream.
+	WriteBit(bool) error
+}
+
+type bitReader struct {
+	reader BitReader
+}
+
+// NewBitReader returns io.Reader which assembles bytes from bits of reader,
+// the most significant bit first. The result can be passed to NewDecoder.
+func NewBitReader(reader BitReader) io.Reader {
+	return &bitReader{reader: reader}
+}
+
+func (r *bitReader) Read(b []byte) (n int, err error) {
+	var bit bool
+	for n < len(b) {
+		b[n] = 0
+		for i := 7; i >= 0; i-- {
+			bit, err = r.reader.ReadBit()
+			if err == io.EOF && i < 7 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return
+			}
+			if bit {
+				b[n] |= 1 << uint(i)
+			}
+		}
+		n++
+	}
+	return
+}
+
+type bitWriter struct {
+	writer BitWriter
+}
+
+// NewBitWriter returns io.Writer which splits bytes to bits of writer,
+// the most significant bit first. The result can be passed to NewEncoder.
+func NewBitWriter(writer BitWriter) io.Writer {
+	return &bitWriter{writer: writer}
+}
+
+func (w *bitWriter) Write(b []byte) (n int, err error) {
+	for _, c := range b {
+		for i := 7; i >= 0; i-- {
+			err = w.writer.WriteBit(c&(1<<uint(i)) != 0)
+			if err != nil {
+				return
+			}
+		}
+		n++
+	}
+	return
+}
+
+// ReadStopBitEntity reads bytes from reader up to and including the byte with
+// stop bit, which is the least unit of FAST-encoded data. Decoder reads
+// presence maps, integers and strings by this primitive.
+func ReadStopBitEntity(reader io.Reader) ([]byte, error) {
+	entity, err := readStopBitEntity(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// WriteStopBitEntity writes 7-bit data to writer, setting the stop bit on
+// the last byte and clearing it on the others. Encoder writes presence maps,
+// integers and strings by this primitive.
+func WriteStopBitEntity(writer io.Writer, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	entity := make([]byte, len(data))
+	copy(entity, data)
+	return writeStopBitEntity(writer, entity)
+}
+
+// readStopBitEntity appends stop bit entity read from reader to buf.
+func readStopBitEntity(reader io.Reader, buf []byte) ([]byte, error) {
+	start := len(buf)
+	for {
+		buf = append(buf, 0)
+		if _, err := io.ReadFull(reader, buf[len(buf)-1:]); err != nil {
+			if err == io.EOF && len(buf)-1 > start {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf[:len(buf)-1], err
+		}
+
+		if buf[len(buf)-1]&stopBit != 0 {
+			return buf, nil
+		}
+	}
+}
+
+// writeStopBitEntity sets stop bits of data in place and writes it to writer.
+func writeStopBitEntity(writer io.Writer, data []byte) error {
+	for i := 0; i < len(data)-1; i++ {
+		data[i] &^= stopBit
+	}
+	data[len(data)-1] |= stopBit
+
+	_, err := writer.Write(data)
+	return err
+}
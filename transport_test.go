@@ -0,0 +1,83 @@
+// Copyright 2018 Alexander Poltoratskiy. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fast_test
+
+import (
+	"bytes"
+	"github.com/co11ter/goFAST"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// bitLink is a trivial bit transport.
+type bitLink struct {
+	bits []bool
+}
+
+func (l *bitLink) WriteBit(bit bool) error {
+	l.bits = append(l.bits, bit)
+	return nil
+}
+
+func (l *bitLink) ReadBit() (bool, error) {
+	if len(l.bits) == 0 {
+		return false, io.EOF
+	}
+	bit := l.bits[0]
+	l.bits = l.bits[1:]
+	return bit, nil
+}
+
+func TestBitTransport(t *testing.T) {
+	tpls := decoderTemplates(t)
+	link := &bitLink{}
+
+	err := fast.NewEncoder(fast.NewBitWriter(link), tpls...).Encode(&decimalMessage1)
+	if err != nil {
+		t.Fatal("can not encode", err)
+	}
+
+	if len(link.bits) != len(decimalData1)*8 {
+		t.Fatalf("wrong count of bits, got: %d, expect: %d", len(link.bits), len(decimalData1)*8)
+	}
+
+	var msg decimalType
+	if err = fast.NewDecoder(fast.NewBitReader(link), tpls...).Decode(&msg); err != nil {
+		t.Fatal("can not decode", err)
+	}
+
+	if !reflect.DeepEqual(&msg, &decimalMessage1) {
+		t.Fatal("messages is not equal, got: ", msg, ", expect: ", decimalMessage1)
+	}
+}
+
+func TestStopBitEntity(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := fast.WriteStopBitEntity(buf, []byte{0x04, 0x83}); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteByte(0x81)
+
+	entity, err := fast.ReadStopBitEntity(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entity, []byte{0x04, 0x83}) {
+		t.Fatalf("wrong entity, got: %x", entity)
+	}
+
+	entity, err = fast.ReadStopBitEntity(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entity, []byte{0x81}) {
+		t.Fatalf("wrong entity, got: %x", entity)
+	}
+
+	if _, err = fast.ReadStopBitEntity(buf); err != io.EOF {
+		t.Fatal("expected EOF, got: ", err)
+	}
+}
@@ -46,33 +46,32 @@ func (w *writer) Reset() {
 	w.dataBuf.Reset()
 }
 
+// WritePMap writes presence map with 7 bits per byte, starting from the most
+// significant bit of bitmap. Trailing zero bytes are not written, so unused
+// bits are always zero. Presence map with more than 63 bits returns ErrPMapOverflow.
 func (w *writer) WritePMap(m *pMap) error {
-	var err error
-	if m.bitmap == 0 {
-		_, err = w.pMapBuf.Write([]byte{0x80})
-		return err
+	if m.mask == 0 {
+		return ErrPMapOverflow
 	}
 
-	b := make([]byte, 8)
-	i :=7
-	for i >= 0 && m.bitmap != 0 {
-		b[i] = byte(m.bitmap)
-		m.bitmap >>= 7
-		i--
+	b := make([]byte, 0, 9)
+	bitmap := m.bitmap
+	for {
+		b = append(b, byte(bitmap>>56)&0x7F)
+		bitmap = (bitmap << 7) &^ defaultMask
+		if bitmap == 0 {
+			break
+		}
 	}
-	b[7] |= 0x80
-
-	_, err = w.pMapBuf.Write(b[i+1:])
-	return err
+	return writeStopBitEntity(w.pMapBuf, b)
 }
 
 func (w *writer) WriteUint(nullable bool, value uint64, size int) (err error) {
 	if !nullable && value == 0 {
-		_, err = w.dataBuf.Write([]byte{0x80})
-		return
+		return writeStopBitEntity(w.dataBuf, []byte{0x00})
 	}
 
-	if nullable && value > 0 {
+	if nullable {
 		value++
 	}
 
@@ -84,50 +83,61 @@ func (w *writer) WriteUint(nullable bool, value uint64, size int) (err error) {
 		i--
 	}
 
-	b[size] |= 0x80
-	_, err = w.dataBuf.Write(b[i+1:])
-
-	return
+	return writeStopBitEntity(w.dataBuf, b[i+1:])
 }
 
 func (w *writer) WriteInt(nullable bool, value int64, size int) (err error) {
 	if !nullable && value == 0 {
-		_, err = w.dataBuf.Write([]byte{0x80})
-		return
-	}
-
-	positive := value > 0
-
-	if nullable && positive {
-		value++
-	}
-
-	var sign int64
-	if value <= 0 {
-		sign = -1
+		return writeStopBitEntity(w.dataBuf, []byte{0x00})
 	}
 
 	b := make([]byte, size+2)
 	i := size
-	for i >= 0 && value != sign {
-		b[i] = byte(value & 0x7F)
-		value >>= 7
-		i--
-	}
 
-	i++
-	if positive {
+	// zero is here only if nullable, it's encoded as positive value
+	if value >= 0 {
+		// unsigned value, since nullable max int64 is incremented to 2^63
+		tmp := uint64(value)
+		if nullable {
+			tmp++
+		}
+		for i >= 0 && tmp != 0 {
+			b[i] = byte(tmp & 0x7F)
+			tmp >>= 7
+			i--
+		}
+
+		// sign bit of the most significant group has to be zero, so overflow group is added
+		i++
 		if (b[i] & 0x40) > 0 {
 			i--
 			b[i] = 0x00
 		}
-	} else if (b[i] & 0x40) == 0 {
-		i--
-		b[i] = 0x7F
+	} else {
+		for i >= 0 && value != -1 {
+			b[i] = byte(value & 0x7F)
+			value >>= 7
+			i--
+		}
+
+		i++
+		if (b[i] & 0x40) == 0 {
+			i--
+			b[i] = 0x7F
+		}
 	}
 
-	b[size] |= 0x80
-	_, err = w.dataBuf.Write(b[i:size+1])
+	return writeStopBitEntity(w.dataBuf, b[i:size+1])
+}
+
+// WriteFixed writes size low bytes of value in big-endian order.
+func (w *writer) WriteFixed(value uint64, size int) (err error) {
+	b := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		b[i] = byte(value)
+		value >>= 8
+	}
+	_, err = w.dataBuf.Write(b)
 	return
 }
 
@@ -152,25 +162,17 @@ func (w *writer) WriteString(nullable bool, value string) (err error) {
 
 	if len(value) == 1 && value[0] == 0x00 {
 		if nullable {
-			_, err = w.dataBuf.Write([]byte{0x00, 0x00, 0x80})
-		} else {
-			_, err = w.dataBuf.Write([]byte{0x00, 0x80})
+			return writeStopBitEntity(w.dataBuf, []byte{0x00, 0x00, 0x00})
 		}
-		return
-	}
-
-	w.strBuf.WriteString(value[:len(value)-1])
-	_, err = w.dataBuf.Write(w.strBuf.Bytes())
-	if err != nil {
-		return
+		return writeStopBitEntity(w.dataBuf, []byte{0x00, 0x00})
 	}
 
+	w.strBuf.WriteString(value)
+	err = writeStopBitEntity(w.dataBuf, w.strBuf.Bytes())
 	w.strBuf.Reset()
-	_, err = w.dataBuf.Write([]byte{value[len(value)-1] | 0x80})
 	return
 }
 
 func (w *writer) WriteNil() error {
-	_, err := w.dataBuf.Write([]byte{0x80})
-	return err
+	return writeStopBitEntity(w.dataBuf, []byte{0x00})
 }